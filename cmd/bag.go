@@ -0,0 +1,114 @@
+/*
+Copyright © 2025 archangelgroup.co
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slice/cmd/utils"
+	"slice/internal/bagit"
+
+	"github.com/spf13/cobra"
+)
+
+// bagCmd represents the bag command
+var bagCmd = &cobra.Command{
+	Use:   "bag",
+	Short: "package a manifest or subset as a BagIt (RFC 8493) bag",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		manifestFile := cmd.Flag("manifest-file").Value.String()
+		root := cmd.Flag("root").Value.String()
+		output := cmd.Flag("output").Value.String()
+		asTar, _ := cmd.Flags().GetBool("tar")
+		force, _ := cmd.Flags().GetBool("force")
+		algorithms, _ := cmd.Flags().GetStringSlice("algorithm")
+		infoPairs, _ := cmd.Flags().GetStringArray("info")
+
+		if manifestFile == "" || output == "" {
+			log.Fatal("need both a manifest file and an output path")
+		}
+
+		manifest, err := utils.LoadManifest(manifestFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		info, err := bagit.ParseInfo(infoPairs)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = bagit.Create(manifest, bagit.Options{
+			Root:       root,
+			Output:     output,
+			Tar:        asTar,
+			Force:      force,
+			Algorithms: algorithms,
+			Info:       info,
+			Software:   fmt.Sprintf("%s %s", appName, version),
+		})
+		if err != nil {
+			log.Fatal("Failed to create bag:", err)
+		}
+
+		fmt.Printf("bag created at %s\n", output)
+	},
+}
+
+// bagValidateCmd represents the bag validate command
+var bagValidateCmd = &cobra.Command{
+	Use:   "validate <bag>",
+	Short: "validate a BagIt bag directory or tarball",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		problems, err := bagit.Validate(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(problems) > 0 {
+			for _, p := range problems {
+				fmt.Println(p)
+			}
+			fmt.Printf("bag is invalid: %d problems\n", len(problems))
+			os.Exit(1)
+		}
+
+		fmt.Println("bag is valid")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bagCmd)
+	bagCmd.AddCommand(bagValidateCmd)
+
+	bagCmd.Flags().StringP("manifest-file", "f", "", "source manifest or subset csv")
+	bagCmd.Flags().String("root", ".", "directory the manifest's relative paths resolve against")
+	bagCmd.Flags().StringP("output", "o", "", "bag directory, or tarball path with --tar")
+	bagCmd.Flags().Bool("tar", false, "write a .tar.gz instead of a directory")
+	bagCmd.Flags().Bool("force", false, "overwrite an existing tarball")
+	bagCmd.Flags().StringSlice("algorithm", []string{"sha256"}, "checksum algorithms: md5, sha1, sha256, sha512")
+	bagCmd.Flags().StringArray("info", nil, "extra bag-info.txt label as Label=value, repeatable")
+}
@@ -0,0 +1,231 @@
+/*
+Copyright © 2025 contact@epyklab.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"slice/internal/database/schema"
+	"slice/internal/database/sync"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// openRemote connects to the postgres db in DB_CONN_STRING
+func openRemote() *sql.DB {
+	DB_CONN_STRING := os.Getenv("DB_CONN_STRING")
+	if DB_CONN_STRING == "" {
+		log.Fatal("need to have conn string environmental variable set")
+	}
+
+	db, err := sql.Open("postgres", DB_CONN_STRING)
+	if err != nil {
+		log.Fatal("Failed to connect to PostgreSQL:", err)
+	}
+	if err = db.Ping(); err != nil {
+		log.Fatal("PostgreSQL ping failed:", err)
+	}
+	return db
+}
+
+// dbCmd represents the db command
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "manage the remote postgres db",
+	Long:  ``,
+}
+
+// dbMigrateCmd represents the db migrate command
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "create or upgrade the documents schema",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		db := openRemote()
+		defer db.Close()
+
+		applied, err := schema.Migrate(db)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	},
+}
+
+// dbStatusCmd represents the db status command
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show applied migrations and differences from the expected schema",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		db := openRemote()
+		defer db.Close()
+
+		migrations, err := schema.Migrations()
+		if err != nil {
+			log.Fatal(err)
+		}
+		applied, err := schema.Applied(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, m := range migrations {
+			state := "pending"
+			if applied[m.Version] {
+				state = "applied"
+			}
+			fmt.Printf("%-8s %04d_%s\n", state, m.Version, m.Name)
+		}
+
+		diff, err := schema.Diff(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println()
+		if len(diff) == 0 {
+			fmt.Println("schema matches")
+			return
+		}
+		for _, line := range diff {
+			fmt.Println(line)
+		}
+	},
+}
+
+// dbVerifyCmd represents the db verify command
+var dbVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "compare synced rows with their sqlite sources",
+	Long: `Compares row counts and checksums of id, content_hash and
+extraction_version per id range between each sqlite db and the rows
+synced from it, and lists the id ranges that differ.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		sqlitePath := cmd.Flag("sqlite").Value.String()
+		sourceName := cmd.Flag("source-name").Value.String()
+		mappingFile := cmd.Flag("mapping").Value.String()
+		sanitize, _ := cmd.Flags().GetStringSlice("sanitize")
+		charset := cmd.Flag("charset").Value.String()
+		maxContentBytes, _ := cmd.Flags().GetInt("max-content-bytes")
+		rangeSize, _ := cmd.Flags().GetInt("range-size")
+
+		mapping := sync.DefaultMapping()
+		if mappingFile != "" {
+			var err error
+			mapping, err = sync.LoadMapping(mappingFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		db := openRemote()
+		defer db.Close()
+
+		sync.VerifyWithRemote(db, sync.Config{
+			SQLiteDBPath:    sqlitePath,
+			SourceName:      sourceName,
+			Mapping:         mapping,
+			Sanitize:        sanitize,
+			Charset:         charset,
+			MaxContentBytes: maxContentBytes,
+			VerifyRangeSize: rangeSize,
+		})
+	},
+}
+
+// dbHistoryCmd represents the db history command
+var dbHistoryCmd = &cobra.Command{
+	Use:   "history [run-id]",
+	Short: "list past sync runs, or show one in full",
+	Long: `Lists the sync runs recorded in sync_runs, newest first, with who
+ran them, how long they took and what happened to their records. Given
+a run id it shows that run in full, including the source digest,
+version and flags.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sourceName := cmd.Flag("source-name").Value.String()
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		db := openRemote()
+		defer db.Close()
+
+		if len(args) == 1 {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				log.Fatalf("run id %q is not a number", args[0])
+			}
+			if err = sync.PrintRun(os.Stdout, db, id); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		if err := sync.PrintHistory(db, sourceName, limit); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// dbCollectionsCmd represents the db collections command
+var dbCollectionsCmd = &cobra.Command{
+	Use:   "collections",
+	Short: "list collections with their source and document counts",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		db := openRemote()
+		defer db.Close()
+
+		if err := sync.PrintCollections(db); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbVerifyCmd)
+	dbCmd.AddCommand(dbHistoryCmd)
+	dbCmd.AddCommand(dbCollectionsCmd)
+
+	dbVerifyCmd.Flags().StringP("sqlite", "s", "", "path to local sqlite db, or a quoted glob such as 'out/*.db'")
+	dbVerifyCmd.Flags().String("source-name", "", "source identifier for a single sqlite db, defaults to its file name")
+	dbVerifyCmd.Flags().String("mapping", "", "json column mapping config the sources were synced with")
+	dbVerifyCmd.Flags().StringSlice("sanitize", sync.DEFAULT_SANITIZE, "sanitization rules the sources were synced with")
+	dbVerifyCmd.Flags().String("charset", "", "charset the sources were synced with")
+	dbVerifyCmd.Flags().Int("max-content-bytes", 0, "content truncation the sources were synced with")
+	dbVerifyCmd.Flags().Int("range-size", sync.DEFAULT_VERIFY_RANGE, "ids per checksummed range")
+
+	dbHistoryCmd.Flags().String("source-name", "", "only list runs of this source")
+	dbHistoryCmd.Flags().Int("limit", 20, "number of runs to list")
+}
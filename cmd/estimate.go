@@ -0,0 +1,146 @@
+/*
+Copyright © 2025 archangelgroup.co
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slice/cmd/utils"
+	"slice/internal/estimate"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// estimateCmd represents the estimate command
+var estimateCmd = &cobra.Command{
+	Use:   "estimate <subset>...",
+	Short: "estimate how long TheScribe will take to process one or more subsets",
+	Long: `Combine the per mime type byte totals of each subset with a throughput
+profile. Every file given is treated as one shard; shards are assumed to
+run in parallel for the wall clock estimate.
+
+A profile is a json file such as:
+  {
+    "default_bytes_per_sec": 1048576,
+    "per_file_sec": 0.2,
+    "mime_types": {"application/pdf": 250000}
+  }`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		profileFile := cmd.Flag("profile").Value.String()
+		root := cmd.Flag("root").Value.String()
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		profile := estimate.DefaultProfile()
+		if profileFile != "" {
+			var err error
+			profile, err = estimate.LoadProfile(profileFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		var shards []estimate.Result
+		for _, file := range args {
+			manifest, err := utils.LoadManifest(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// Older manifests have no sizes, fill them in from disk
+			if root != "" {
+				for i, entry := range manifest.Nodes {
+					if entry.Size != nil {
+						continue
+					}
+					info, err := os.Stat(filepath.Join(root, entry.RelativePath))
+					if err == nil {
+						size := info.Size()
+						manifest.Nodes[i].Size = &size
+					}
+				}
+			}
+
+			shards = append(shards, estimate.Estimate(filepath.Base(file), manifest.Nodes, profile))
+		}
+
+		overall := estimate.Merge("overall", shards)
+
+		var wall time.Duration
+		for _, shard := range shards {
+			wall = max(wall, shard.Duration)
+		}
+
+		if asJSON {
+			final, err := json.MarshalIndent(map[string]any{
+				"shards":    shards,
+				"overall":   overall,
+				"wall_time": wall,
+			}, "", "	")
+			if err != nil {
+				log.Println(err)
+			}
+			fmt.Print(string(final))
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SHARD\tFILES\tBYTES\tESTIMATE")
+		for _, shard := range append(shards, overall) {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", shard.Name, shard.Files, shard.Bytes, shard.Duration.Round(time.Second))
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintln(w, "MIME TYPE\tFILES\tBYTES\tESTIMATE")
+		mimeTypes := make([]string, 0, len(overall.ByMime))
+		for mimeType := range overall.ByMime {
+			mimeTypes = append(mimeTypes, mimeType)
+		}
+		sort.Slice(mimeTypes, func(i, j int) bool {
+			return overall.ByMime[mimeTypes[i]].Duration > overall.ByMime[mimeTypes[j]].Duration
+		})
+		for _, mimeType := range mimeTypes {
+			t := overall.ByMime[mimeType]
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", mimeType, t.Files, t.Bytes, t.Duration.Round(time.Second))
+		}
+		w.Flush()
+
+		fmt.Printf("\nwall clock with %d shards in parallel: %s\n", len(shards), wall.Round(time.Second))
+		if overall.Unsized > 0 {
+			fmt.Printf("%d files have no size and only count the per file cost, re-index or pass --root\n", overall.Unsized)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(estimateCmd)
+
+	estimateCmd.Flags().String("profile", "", "throughput profile json, bytes/sec per mime type")
+	estimateCmd.Flags().String("root", "", "dataset root used to look up sizes missing from the subset")
+	estimateCmd.Flags().Bool("json", false, "print the estimate as json")
+}
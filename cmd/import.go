@@ -0,0 +1,157 @@
+/*
+Copyright © 2025 archangelgroup.co
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slice/cmd/utils"
+	"slice/internal/models"
+	"slice/internal/types"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "create a manifest from a subset csv or another tool's file inventory",
+	Long: `Read a csv, tsv, jsonl or json inventory and print it as a manifest.
+
+Presets cover the subset csv written by slice and common inventories:
+  slice      csv written by the subset command
+  rclone     rclone lsjson output
+  find       find . -type f -printf '%P\t%s\n'
+  md5sum     md5sum output
+  sha256sum  sha256sum output
+
+Use --map field=column to override or extend the preset. Fields are
+relative_path, file_extension, mime_type, parser_version, content_hash,
+size and is_dir. Headerless files use $1, $2, ... as column names.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		inputFile := args[0]
+		preset := cmd.Flag("preset").Value.String()
+		format := cmd.Flag("format").Value.String()
+		mapSpec := cmd.Flag("map").Value.String()
+		name, _ := cmd.Flags().GetString("name")
+		noHeader, _ := cmd.Flags().GetBool("no-header")
+		parserVersion, _ := cmd.Flags().GetInt("parser-version")
+
+		base, ok := utils.ImportPresets[preset]
+		if !ok {
+			log.Fatalf("unknown preset %q", preset)
+		}
+
+		opts := utils.ImportOptions{
+			Format:        base.Format,
+			NoHeader:      base.NoHeader || noHeader,
+			Mapping:       make(map[string]string),
+			Optional:      base.Optional,
+			ParserVersion: parserVersion,
+		}
+		for field, column := range base.Mapping {
+			opts.Mapping[field] = column
+		}
+
+		if format != "auto" {
+			opts.Format = format
+		} else if preset == "slice" {
+			opts.Format = utils.DetectFormat(inputFile)
+		}
+
+		mapping, err := utils.ParseMapping(mapSpec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for field, column := range mapping {
+			opts.Mapping[field] = column
+		}
+
+		nodes, err := utils.ReadInventory(inputFile, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
+		}
+
+		digest, err := utils.FileDigest(inputFile)
+		if err != nil {
+			log.Println(err)
+		}
+
+		params := make(map[string]string)
+		cmd.Flags().Visit(func(f *pflag.Flag) {
+			params[f.Name] = f.Value.String()
+		})
+
+		provenance := &models.Provenance{
+			SourceName:   filepath.Base(inputFile),
+			SourceType:   types.Inventory,
+			SourceFile:   inputFile,
+			SourceDigest: digest,
+			Params:       params,
+			CreatedAt:    time.Now(),
+		}
+
+		// An edited subset keeps its lineage through the sidecar
+		// written by the subset command
+		if subset, err := utils.ReadArtifact(inputFile); err == nil {
+			provenance.SourceName = subset.Name
+			provenance.SourceType = subset.DType
+			provenance.SourceDateTime = subset.DateTime
+			provenance.Parent = subset.Provenance
+		}
+
+		manifest := models.Manifest{
+			DType:      types.Import,
+			DateTime:   time.Now(),
+			Name:       name,
+			Provenance: provenance,
+			Nodes:      nodes,
+		}
+
+		final, err := json.MarshalIndent(manifest, "", "	")
+		if err != nil {
+			log.Println(err)
+		}
+		fmt.Print(string(final))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().String("preset", "slice", "column mapping preset: slice, rclone, find, md5sum or sha256sum")
+	importCmd.Flags().String("format", "auto", "input format: auto, csv, tsv, jsonl, json or sums")
+	importCmd.Flags().String("map", "", "column mapping as field=column pairs separated by commas")
+	importCmd.Flags().Bool("no-header", false, "input has no header row, columns are named $1, $2, ...")
+	importCmd.Flags().String("name", "", "name of the manifest, defaults to the input file name")
+	importCmd.Flags().Int("parser-version", 1, "parser version for rows without one")
+}
@@ -29,6 +29,7 @@ import (
 	"os"
 	"path/filepath"
 	"slice/internal/models"
+	"slice/internal/types"
 	"strings"
 	"time"
 
@@ -58,11 +59,13 @@ func handler() filepath.WalkFunc {
 				log.Println(err)
 			}
 
+			size := pathInfo.Size()
 			entry := models.Entry{
 				MimeType:      strings.Split(ftype, ";")[0],
 				RelativePath:  relPath,
 				FileExtension: filepath.Ext(filep),
 				ParserVersion: 1,
+				Size:          &size,
 			}
 			dirTreeIndex = append(dirTreeIndex, entry)
 		}
@@ -91,6 +94,7 @@ var indexCmd = &cobra.Command{
 		}
 
 		dsIndex := models.Manifest{
+			DType:    types.Index,
 			DateTime: time.Now(),
 			Name:     name,
 			Nodes:    dirTreeIndex,
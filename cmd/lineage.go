@@ -0,0 +1,92 @@
+/*
+Copyright © 2025 archangelgroup.co
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"slice/cmd/utils"
+	"slice/internal/models"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// lineageCmd represents the lineage command
+var lineageCmd = &cobra.Command{
+	Use:   "lineage <file>",
+	Short: "print the chain from a subset back to its original index run",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		artifact, err := utils.ReadArtifact(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("%s %s (%s)\n", artifact.DType, artifact.Name, artifact.DateTime.Format(time.RFC3339))
+
+		depth := 1
+		for p := artifact.Provenance; p != nil; p = p.Parent {
+			printProvenance(p, depth)
+			depth++
+		}
+	},
+}
+
+// printProvenance prints one link of the chain, indented by its depth,
+// and checks the digest of the source file if it is still on disk
+func printProvenance(p *models.Provenance, depth int) {
+	indent := fmt.Sprintf("%*s", depth*2, "")
+
+	status := "source file not recorded"
+	if p.SourceFile != "" {
+		digest, err := utils.FileDigest(p.SourceFile)
+		switch {
+		case err != nil:
+			status = "source file missing"
+		case digest == p.SourceDigest:
+			status = "digest ok"
+		default:
+			status = "digest changed"
+		}
+	}
+
+	fmt.Printf("%s<- %s %s (%s)\n", indent, p.SourceType, p.SourceName, p.SourceDateTime.Format(time.RFC3339))
+	fmt.Printf("%s   file:    %s\n", indent, p.SourceFile)
+	fmt.Printf("%s   digest:  %s [%s]\n", indent, p.SourceDigest, status)
+	fmt.Printf("%s   created: %s\n", indent, p.CreatedAt.Format(time.RFC3339))
+
+	keys := make([]string, 0, len(p.Params))
+	for k := range p.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("%s   --%s=%s\n", indent, k, p.Params[k])
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(lineageCmd)
+}
@@ -23,12 +23,18 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"slice/cmd/utils"
+	"slice/internal/database/processed"
 	"slice/internal/models"
+	"slice/internal/types"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // subsetCmd represents the subset command
@@ -40,6 +46,9 @@ var subsetCmd = &cobra.Command{
 
 		manifestFile := cmd.Flag("manifest-file").Value.String()
 		outputFile := cmd.Flag("subset-file-name").Value.String()
+		skipProcessed := cmd.Flag("skip-processed").Value.String()
+		pathPrefix := cmd.Flag("path-prefix").Value.String()
+		collection := cmd.Flag("collection").Value.String()
 
 		var manifest models.Manifest
 
@@ -53,7 +62,63 @@ var subsetCmd = &cobra.Command{
 			log.Println(err)
 		}
 
-		err = utils.WriteToCSV(outputFile, manifest.Nodes)
+		nodes := manifest.Nodes
+		if skipProcessed != "" {
+			docs, err := processed.Load(skipProcessed, collection)
+			if err != nil {
+				log.Fatal("Failed to load processed documents:", err)
+			}
+
+			var skipped int
+			nodes, skipped = processed.Filter(nodes, docs, pathPrefix)
+			fmt.Printf("skipped %d already processed entries\n", skipped)
+		}
+
+		err = utils.WriteToCSV(outputFile, nodes)
+		if err != nil {
+			log.Println(err)
+		}
+
+		digest, err := utils.FileDigest(manifestFile)
+		if err != nil {
+			log.Println(err)
+		}
+
+		// Record every flag the user set so the subset can be
+		// reproduced from the same source manifest. The sidecar travels
+		// with the csv, so a --skip-processed connection string is
+		// kept without its credentials
+		params := make(map[string]string)
+		cmd.Flags().Visit(func(f *pflag.Flag) {
+			params[f.Name] = f.Value.String()
+		})
+		utils.RedactParams(params)
+
+		sourceType := manifest.DType
+		if sourceType == "" {
+			sourceType = types.Index
+		}
+
+		subset := models.Manifest{
+			DType:    types.Subset,
+			DateTime: time.Now(),
+			Name:     filepath.Base(outputFile),
+			Provenance: &models.Provenance{
+				SourceName:     manifest.Name,
+				SourceType:     sourceType,
+				SourceFile:     manifestFile,
+				SourceDateTime: manifest.DateTime,
+				SourceDigest:   digest,
+				Params:         params,
+				CreatedAt:      time.Now(),
+				Parent:         manifest.Provenance,
+			},
+		}
+
+		err = utils.WriteProvenance(outputFile, subset)
+		if err != nil {
+			log.Println(err)
+		}
 	},
 }
 
@@ -70,5 +135,8 @@ func init() {
 	// is called directly, e.g.:
 	subsetCmd.Flags().StringP("manifest-file", "f", "", "source manifest file")
 	subsetCmd.Flags().StringP("subset-file-name", "o", "", "name of the output subset file")
+	subsetCmd.Flags().String("skip-processed", "", "drop entries already extracted, sqlite db path or 'postgres' to use DB_CONN_STRING")
+	subsetCmd.Flags().String("path-prefix", "", "prefix joined to relative paths to match documents file_path")
+	subsetCmd.Flags().String("collection", "", "with a postgres --skip-processed, only documents of sources in this collection")
 	// subsetCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
@@ -24,9 +24,11 @@ package cmd
 import (
 	"log"
 	"os"
+	"slice/cmd/utils"
 	"slice/internal/database/sync"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // syncCmd represents the sync command
@@ -36,12 +38,109 @@ var syncCmd = &cobra.Command{
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
 		sqlitePath := cmd.Flag("sqlite").Value.String()
+		dest := cmd.Flag("dest").Value.String()
 
 		DB_CONN_STRING := os.Getenv("DB_CONN_STRING")
-		if DB_CONN_STRING == "" {
+		if DB_CONN_STRING == "" && dest == "postgres" {
 			log.Fatal("need to have conn string environmental variable set")
 		}
-		sync.SyncWithRemote(sqlitePath)
+		full, _ := cmd.Flags().GetBool("full")
+		method := cmd.Flag("method").Value.String()
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		deleteMode := cmd.Flag("delete").Value.String()
+		maxDeletePct, _ := cmd.Flags().GetFloat64("max-delete-pct")
+		mappingFile := cmd.Flag("mapping").Value.String()
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		planFormat := cmd.Flag("plan-format").Value.String()
+		planSample, _ := cmd.Flags().GetInt("plan-sample")
+		resume, _ := cmd.Flags().GetBool("resume")
+		workers, _ := cmd.Flags().GetInt("workers")
+		sourceName := cmd.Flag("source-name").Value.String()
+		onError := cmd.Flag("on-error").Value.String()
+		quarantineFile := cmd.Flag("quarantine-file").Value.String()
+		retryQuarantine, _ := cmd.Flags().GetBool("retry-quarantine")
+		sanitize, _ := cmd.Flags().GetStringSlice("sanitize")
+		charset := cmd.Flag("charset").Value.String()
+		maxContentBytes, _ := cmd.Flags().GetInt("max-content-bytes")
+		verify, _ := cmd.Flags().GetBool("verify")
+		conflict := cmd.Flag("conflict").Value.String()
+		listDelimiter := cmd.Flag("list-delimiter").Value.String()
+		entityTables, _ := cmd.Flags().GetBool("entity-tables")
+		metadataSchema := cmd.Flag("metadata-schema").Value.String()
+		verifyRangeSize, _ := cmd.Flags().GetInt("verify-range-size")
+		wait, _ := cmd.Flags().GetBool("wait")
+		stampRun, _ := cmd.Flags().GetBool("stamp-run")
+		collection := cmd.Flag("collection").Value.String()
+		pathRulesFile := cmd.Flag("path-rules").Value.String()
+		pathPrefixes, _ := cmd.Flags().GetStringArray("path-prefix")
+
+		// the flags given are kept with the run in sync_runs, without
+		// the credentials of a --dest connection string
+		flags := make(map[string]string)
+		cmd.Flags().Visit(func(f *pflag.Flag) {
+			flags[f.Name] = f.Value.String()
+		})
+		utils.RedactParams(flags)
+
+		mapping := sync.DefaultMapping()
+		if mappingFile != "" {
+			var err error
+			mapping, err = sync.LoadMapping(mappingFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		var pathRules sync.PathRules
+		if pathRulesFile != "" {
+			var err error
+			pathRules, err = sync.LoadPathRules(pathRulesFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		// prefixes given on the command line are tried first
+		prefixes, err := sync.ParsePrefixRules(pathPrefixes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pathRules.Prefix = append(prefixes, pathRules.Prefix...)
+
+		sync.SyncWithRemote(sync.Config{
+			SQLiteDBPath:    sqlitePath,
+			PostgresDSN:     DB_CONN_STRING,
+			Full:            full,
+			Method:          method,
+			BatchSize:       batchSize,
+			DeleteMode:      deleteMode,
+			MaxDeletePct:    maxDeletePct,
+			Mapping:         mapping,
+			PathRules:       pathRules,
+			DryRun:          dryRun,
+			PlanFormat:      planFormat,
+			PlanSample:      planSample,
+			Resume:          resume,
+			Workers:         workers,
+			SourceName:      sourceName,
+			Dest:            dest,
+			OnError:         onError,
+			QuarantineFile:  quarantineFile,
+			RetryQuarantine: retryQuarantine,
+			Sanitize:        sanitize,
+			Charset:         charset,
+			MaxContentBytes: maxContentBytes,
+			Verify:          verify,
+			VerifyRangeSize: verifyRangeSize,
+			Conflict:        conflict,
+			ListDelimiter:   listDelimiter,
+			EntityTables:    entityTables,
+			MetadataSchema:  metadataSchema,
+			Wait:            wait,
+			Version:         version,
+			Flags:           flags,
+			StampRun:        stampRun,
+			Collection:      collection,
+		})
 	},
 }
 
@@ -56,6 +155,36 @@ func init() {
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
-	syncCmd.Flags().StringP("sqlite", "s", "", "path to local sqlite db")
+	syncCmd.Flags().StringP("sqlite", "s", "", "path to local sqlite db, or a quoted glob such as 'out/*.db'")
+	syncCmd.Flags().String("dest", "postgres", "where to write: postgres (DB_CONN_STRING), a postgres:// url, a .jsonl export file or a sqlite db to consolidate into")
+	syncCmd.Flags().String("source-name", "", "source identifier for a single sqlite db, defaults to its file name")
+	syncCmd.Flags().String("collection", "", "collection to put new sources in, defaults to "+sync.DEFAULT_COLLECTION+", a source with documents stays in its own")
+	syncCmd.Flags().Bool("full", false, "ignore the high-water mark and resend every row")
+	syncCmd.Flags().String("method", sync.METHOD_COPY, "write method: copy (bulk COPY and merge) or row (one statement per row)")
+	syncCmd.Flags().Int("batch-size", sync.DEFAULT_BATCH_SIZE, "rows per transaction")
+	syncCmd.Flags().String("delete", sync.DELETE_NONE, "propagate rows missing from the source: none, hard or tombstone")
+	syncCmd.Flags().Float64("max-delete-pct", 10, "abort if more than this percent of remote rows would be deleted")
+	syncCmd.Flags().Bool("resume", false, "continue an interrupted sync from its last committed batch")
+	syncCmd.Flags().Int("workers", 1, "number of id ranges synced concurrently, each on its own connection")
+	syncCmd.Flags().Bool("wait", false, "wait for another sync of the same source to finish instead of failing")
+	syncCmd.Flags().Bool("stamp-run", false, "set documents.sync_run_id to this run on every row written")
+	syncCmd.Flags().String("conflict", sync.DEFAULT_CONFLICT, "when a row already exists: source-wins, newer-extraction-wins (higher extraction_version wins), skip-existing or fail")
+	syncCmd.Flags().String("list-delimiter", "", "delimiter for urls, names, places and tokens that are not JSON arrays, detected when empty (urls split on a comma or semicolon only between urls)")
+	syncCmd.Flags().Bool("entity-tables", false, "also fill the document_urls and document_entities tables")
+	syncCmd.Flags().String("metadata-schema", "", "JSON Schema file metadata must match, failures follow --on-error")
+	syncCmd.Flags().String("on-error", sync.ERROR_ABORT, "when a record fails to write: abort, skip (kept as skipped for --retry-quarantine) or quarantine")
+	syncCmd.Flags().String("quarantine-file", "", "jsonl file for quarantined records, defaults to the sync_quarantine table on postgres")
+	syncCmd.Flags().Bool("retry-quarantine", false, "resend the quarantined and skipped records of each source instead of syncing")
+	syncCmd.Flags().StringSlice("sanitize", sync.DEFAULT_SANITIZE, "text sanitization rules: utf8 (repair invalid UTF-8 and decode UTF-16), control (strip control characters but tab, newlines and form feed), nfc (normalize)")
+	syncCmd.Flags().String("charset", "", "transcode text that is not valid UTF-8 from latin1 or windows-1252 instead of replacing invalid bytes")
+	syncCmd.Flags().Int("max-content-bytes", 0, "truncate content to this many bytes, 0 keeps it whole")
+	syncCmd.Flags().Bool("verify", false, "compare row counts and per id range checksums with postgres after syncing")
+	syncCmd.Flags().Int("verify-range-size", sync.DEFAULT_VERIFY_RANGE, "ids per checksummed range when verifying")
+	syncCmd.Flags().Bool("dry-run", false, "print what would change without writing anything")
+	syncCmd.Flags().String("plan-format", "text", "dry run plan format: text or json, json prints one array for all sources")
+	syncCmd.Flags().Int("plan-sample", 0, "number of affected ids to list per outcome in the plan")
+	syncCmd.Flags().String("mapping", "", "json column mapping config, source column to target column with optional transforms")
+	syncCmd.Flags().String("path-rules", "", "json path rewrite config with prefix and regex rules, the result is stored as canonical_path")
+	syncCmd.Flags().StringArray("path-prefix", nil, "rewrite a leading path prefix, as from=to, may be repeated")
 	// syncCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
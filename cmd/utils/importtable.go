@@ -0,0 +1,378 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"slice/internal/models"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Entry fields a column can be mapped to. is_dir is not stored, rows
+// where it is "true" are skipped
+var importFields = []string{"relative_path", "file_extension", "mime_type", "parser_version", "content_hash", "size", "is_dir"}
+
+// ImportOptions configures how an inventory file is read. Mapping keys
+// are entry fields and values are source column names, or $N (1 based)
+// for files without a header. Optional fields may be missing from
+// the file without failing the import
+type ImportOptions struct {
+	Format        string
+	NoHeader      bool
+	Mapping       map[string]string
+	Optional      []string
+	ParserVersion int
+}
+
+// ImportPresets holds the format and column mapping of known inventory
+// producers. "slice" is the exact format WriteToCSV emits
+var ImportPresets = map[string]ImportOptions{
+	"slice": {
+		Format: "csv",
+		Mapping: map[string]string{
+			"relative_path":  "relative_path",
+			"file_extension": "file_extension",
+			"mime_type":      "mime_type",
+			"parser_version": "parser_version",
+			"size":           "size",
+			"content_hash":   "content_hash",
+		},
+		// size and content_hash were added after the first release,
+		// so subset csvs written before them still import
+		Optional: []string{"size", "content_hash"},
+	},
+	"rclone": {
+		Format: "json",
+		Mapping: map[string]string{
+			"relative_path": "Path",
+			"mime_type":     "MimeType",
+			"size":          "Size",
+			"is_dir":        "IsDir",
+		},
+	},
+	// find . -type f -printf '%P\t%s\n'
+	"find": {
+		Format:   "tsv",
+		NoHeader: true,
+		Mapping: map[string]string{
+			"relative_path": "$1",
+			"size":          "$2",
+		},
+		Optional: []string{"size"},
+	},
+	"md5sum": {
+		Format:   "sums",
+		NoHeader: true,
+		Mapping: map[string]string{
+			"content_hash":  "$1",
+			"relative_path": "$2",
+		},
+	},
+	"sha256sum": {
+		Format:   "sums",
+		NoHeader: true,
+		Mapping: map[string]string{
+			"content_hash":  "$1",
+			"relative_path": "$2",
+		},
+	},
+}
+
+// ParseMapping parses field=column pairs separated by commas
+func ParseMapping(spec string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if spec == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mapping %q, expected field=column", pair)
+		}
+		field = strings.TrimSpace(field)
+		if !slices.Contains(importFields, field) {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(importFields, ", "))
+		}
+		mapping[field] = strings.TrimSpace(column)
+	}
+
+	return mapping, nil
+}
+
+// DetectFormat guesses the format of an inventory from its extension
+func DetectFormat(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".tsv", ".tab":
+		return "tsv"
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	case ".json":
+		return "json"
+	case ".md5", ".sha256", ".sha256sum", ".md5sum":
+		return "sums"
+	default:
+		return "csv"
+	}
+}
+
+// ReadInventory reads a csv, tsv, jsonl, json or checksum file into
+// manifest entries. Every row is validated and all problems are
+// returned together so a spreadsheet can be fixed in one pass
+func ReadInventory(fileName string, opts ImportOptions) ([]models.Entry, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rows []map[string]string
+	switch opts.Format {
+	case "csv":
+		rows, err = readDelimited(file, ',', opts.NoHeader)
+	case "tsv":
+		rows, err = readDelimited(file, '\t', opts.NoHeader)
+	case "jsonl":
+		rows, err = readJSONLines(file)
+	case "json":
+		rows, err = readJSONArray(file)
+	case "sums":
+		rows, err = readSums(file)
+	default:
+		return nil, fmt.Errorf("unknown format %q", opts.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := opts.Mapping["relative_path"]; !ok {
+		return nil, fmt.Errorf("no column mapped to relative_path")
+	}
+
+	// Check the mapped columns exist before looking at any values
+	if len(rows) > 0 && opts.Format != "json" && opts.Format != "jsonl" {
+		for field, column := range opts.Mapping {
+			optional := slices.Contains(opts.Optional, field)
+			if _, ok := rows[0][column]; !ok && !optional {
+				return nil, fmt.Errorf("column %q mapped to %s not found", column, field)
+			}
+		}
+	}
+
+	var entries []models.Entry
+	var problems []string
+	seen := make(map[string]int)
+
+	for i, row := range rows {
+		line := i + 1
+		if !opts.NoHeader && (opts.Format == "csv" || opts.Format == "tsv") {
+			line++
+		}
+
+		if opts.Mapping["is_dir"] != "" && row[opts.Mapping["is_dir"]] == "true" {
+			continue
+		}
+
+		entry, err := rowToEntry(row, opts)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+
+		if prev, ok := seen[entry.RelativePath]; ok {
+			problems = append(problems, fmt.Sprintf("line %d: duplicate relative_path %q, first seen on line %d", line, entry.RelativePath, prev))
+			continue
+		}
+		seen[entry.RelativePath] = line
+
+		entries = append(entries, entry)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%d invalid rows:\n%s", len(problems), strings.Join(problems, "\n"))
+	}
+
+	return entries, nil
+}
+
+// rowToEntry converts a single row using the column mapping, filling
+// in the extension and mime type the same way index does
+func rowToEntry(row map[string]string, opts ImportOptions) (models.Entry, error) {
+	value := func(field string) string {
+		column, ok := opts.Mapping[field]
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(row[column])
+	}
+
+	entry := models.Entry{
+		RelativePath:  filepath.ToSlash(filepath.Clean(value("relative_path"))),
+		FileExtension: value("file_extension"),
+		MimeType:      value("mime_type"),
+		ContentHash:   value("content_hash"),
+		ParserVersion: opts.ParserVersion,
+	}
+
+	if value("relative_path") == "" {
+		return entry, fmt.Errorf("empty relative_path")
+	}
+	if !filepath.IsLocal(entry.RelativePath) {
+		return entry, fmt.Errorf("relative_path %q is not relative to the dataset root", entry.RelativePath)
+	}
+
+	if v := value("parser_version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || version < 0 {
+			return entry, fmt.Errorf("parser_version %q is not a non-negative integer", v)
+		}
+		entry.ParserVersion = version
+	}
+
+	if v := value("size"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size < 0 {
+			return entry, fmt.Errorf("size %q is not a non-negative integer", v)
+		}
+		entry.Size = &size
+	}
+
+	if _, ok := opts.Mapping["file_extension"]; !ok {
+		entry.FileExtension = filepath.Ext(entry.RelativePath)
+	}
+	if _, ok := opts.Mapping["mime_type"]; !ok {
+		ftype := mime.TypeByExtension(entry.FileExtension)
+		entry.MimeType = strings.Split(ftype, ";")[0]
+	}
+
+	return entry, nil
+}
+
+// readDelimited reads csv or tsv. Without a header the columns are
+// named $1, $2, ...
+func readDelimited(r io.Reader, comma rune, noHeader bool) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	if comma == '\t' {
+		reader.LazyQuotes = true
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var header []string
+	if noHeader {
+		for i := range records[0] {
+			header = append(header, fmt.Sprintf("$%d", i+1))
+		}
+	} else {
+		header = records[0]
+		records = records[1:]
+	}
+
+	var rows []map[string]string
+	for i, record := range records {
+		if len(record) != len(header) {
+			return nil, fmt.Errorf("row %d has %d columns, expected %d", i+1, len(record), len(header))
+		}
+		row := make(map[string]string, len(header))
+		for j, column := range header {
+			row[column] = record[j]
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func readJSONLines(r io.Reader) ([]map[string]string, error) {
+	var rows []map[string]string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(text), &obj); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rows = append(rows, stringifyObject(obj))
+	}
+
+	return rows, scanner.Err()
+}
+
+func readJSONArray(r io.Reader) ([]map[string]string, error) {
+	var objs []map[string]any
+	if err := json.NewDecoder(r).Decode(&objs); err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]string, 0, len(objs))
+	for _, obj := range objs {
+		rows = append(rows, stringifyObject(obj))
+	}
+	return rows, nil
+}
+
+// stringifyObject flattens a json object to strings so it can be
+// mapped like a csv row
+func stringifyObject(obj map[string]any) map[string]string {
+	row := make(map[string]string, len(obj))
+	for k, v := range obj {
+		switch val := v.(type) {
+		case nil:
+			row[k] = ""
+		case string:
+			row[k] = val
+		case float64:
+			row[k] = strconv.FormatFloat(val, 'f', -1, 64)
+		default:
+			row[k] = fmt.Sprint(val)
+		}
+	}
+	return row
+}
+
+// readSums reads md5sum/sha256sum output, "<hash>  <path>" or
+// "<hash> *<path>" in binary mode
+func readSums(r io.Reader) ([]map[string]string, error) {
+	var rows []map[string]string
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		hash, path, ok := strings.Cut(text, " ")
+		if !ok || len(path) < 2 || (path[0] != ' ' && path[0] != '*') {
+			return nil, fmt.Errorf("line %d: expected \"<hash>  <path>\"", line)
+		}
+		rows = append(rows, map[string]string{"$1": hash, "$2": strings.TrimPrefix(path[1:], "./")})
+	}
+
+	return rows, scanner.Err()
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slice/internal/models"
+	"strings"
+	"testing"
+)
+
+func size(n int64) *int64 { return &n }
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadInventoryPresets(t *testing.T) {
+	tests := []struct {
+		preset  string
+		file    string
+		content string
+		want    []models.Entry
+	}{
+		{
+			preset: "slice",
+			file:   "subset.csv",
+			content: "relative_path,file_extension,mime_type,parser_version,size,content_hash\n" +
+				"a/b.pdf,.pdf,application/pdf,2,10,abc\n",
+			want: []models.Entry{{RelativePath: "a/b.pdf", FileExtension: ".pdf", MimeType: "application/pdf", ParserVersion: 2, Size: size(10), ContentHash: "abc"}},
+		},
+		{
+			preset: "slice",
+			file:   "old.csv",
+			content: "relative_path,file_extension,mime_type,parser_version\n" +
+				"a.txt,.txt,text/plain,1\n",
+			want: []models.Entry{{RelativePath: "a.txt", FileExtension: ".txt", MimeType: "text/plain", ParserVersion: 1}},
+		},
+		{
+			preset: "rclone",
+			file:   "ls.json",
+			content: `[{"Path":"docs","IsDir":true},` +
+				`{"Path":"docs/a.pdf","MimeType":"application/pdf","Size":42,"IsDir":false}]`,
+			want: []models.Entry{{RelativePath: "docs/a.pdf", FileExtension: ".pdf", MimeType: "application/pdf", Size: size(42)}},
+		},
+		{
+			preset:  "find",
+			file:    "find.tsv",
+			content: "a/b.pdf\t7\nc.pdf\t0\n",
+			want: []models.Entry{
+				{RelativePath: "a/b.pdf", FileExtension: ".pdf", MimeType: "application/pdf", Size: size(7)},
+				{RelativePath: "c.pdf", FileExtension: ".pdf", MimeType: "application/pdf", Size: size(0)},
+			},
+		},
+		{
+			preset:  "md5sum",
+			file:    "files.md5",
+			content: "d41d8cd98f00b204e9800998ecf8427e  ./a.pdf\nd41d8cd98f00b204e9800998ecf8427f *b.pdf\n",
+			want: []models.Entry{
+				{RelativePath: "a.pdf", FileExtension: ".pdf", MimeType: "application/pdf", ContentHash: "d41d8cd98f00b204e9800998ecf8427e"},
+				{RelativePath: "b.pdf", FileExtension: ".pdf", MimeType: "application/pdf", ContentHash: "d41d8cd98f00b204e9800998ecf8427f"},
+			},
+		},
+		{
+			preset:  "sha256sum",
+			file:    "files.sha256",
+			content: "e3b0  a.pdf\n",
+			want:    []models.Entry{{RelativePath: "a.pdf", FileExtension: ".pdf", MimeType: "application/pdf", ContentHash: "e3b0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.preset+"/"+tt.file, func(t *testing.T) {
+			got, err := ReadInventory(writeFile(t, tt.file, tt.content), ImportPresets[tt.preset])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadInventory() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadInventoryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		opts    ImportOptions
+		wantErr string
+	}{
+		{"parent path", "relative_path\n../a.pdf\n", ImportOptions{Format: "csv", Mapping: map[string]string{"relative_path": "relative_path"}}, "not relative"},
+		{"parent dir", "relative_path\na/../..\n", ImportOptions{Format: "csv", Mapping: map[string]string{"relative_path": "relative_path"}}, "not relative"},
+		{"absolute path", "relative_path\n/etc/passwd\n", ImportOptions{Format: "csv", Mapping: map[string]string{"relative_path": "relative_path"}}, "not relative"},
+		{"empty path", "relative_path\n\"\"\n", ImportOptions{Format: "csv", Mapping: map[string]string{"relative_path": "relative_path"}}, "empty relative_path"},
+		{"duplicate", "relative_path\na\n./a\n", ImportOptions{Format: "csv", Mapping: map[string]string{"relative_path": "relative_path"}}, "duplicate"},
+		{"bad size", "relative_path,size\na,-1\n", ImportOptions{Format: "csv", Mapping: map[string]string{"relative_path": "relative_path", "size": "size"}}, "size"},
+		{"missing column", "relative_path\na\n", ImportOptions{Format: "csv", Mapping: map[string]string{"relative_path": "relative_path", "mime_type": "type"}}, "not found"},
+		{"no path mapping", "a\nb\n", ImportOptions{Format: "csv", Mapping: map[string]string{}}, "relative_path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadInventory(writeFile(t, "inv.csv", tt.content), tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadInventory() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubsetRoundTrip(t *testing.T) {
+	entries := []models.Entry{
+		{RelativePath: "a/b.pdf", FileExtension: ".pdf", MimeType: "application/pdf", ParserVersion: 3, Size: size(1024), ContentHash: "sha256:abc"},
+		{RelativePath: "c, d.txt", FileExtension: ".txt", MimeType: "text/plain", ParserVersion: 1},
+	}
+
+	path := filepath.Join(t.TempDir(), "subset.csv")
+	if err := WriteToCSV(path, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := ImportPresets["slice"]
+	opts.Format = DetectFormat(path)
+	got, err := ReadInventory(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("round trip = %+v, want %+v", got, entries)
+	}
+}
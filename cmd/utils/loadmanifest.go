@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slice/internal/models"
+	"strings"
+)
+
+// LoadManifest reads either a json manifest or a subset csv. Subsets
+// take their header from the provenance sidecar when there is one
+func LoadManifest(fileName string) (models.Manifest, error) {
+	var manifest models.Manifest
+
+	if strings.HasSuffix(fileName, ".json") {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return manifest, err
+		}
+		err = json.Unmarshal(data, &manifest)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to parse %s: %v", fileName, err)
+		}
+		return manifest, nil
+	}
+
+	preset := ImportPresets["slice"]
+	preset.Format = DetectFormat(fileName)
+	preset.ParserVersion = 1
+
+	nodes, err := ReadInventory(fileName, preset)
+	if err != nil {
+		return manifest, err
+	}
+
+	if artifact, err := ReadArtifact(fileName); err == nil {
+		manifest = artifact
+	} else {
+		manifest.Name = filepath.Base(fileName)
+	}
+	manifest.Nodes = nodes
+
+	return manifest, nil
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slice/internal/models"
+	"strings"
+)
+
+// ProvenancePath returns the sidecar file that carries the
+// provenance of a csv subset
+func ProvenancePath(fileName string) string {
+	return fileName + ".meta.json"
+}
+
+// FileDigest returns the sha256 digest of a file in the
+// form "sha256:<hex>". The file is streamed, source dbs can be large
+func FileDigest(fileName string) (string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %v", fileName, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteProvenance writes the header of a subset, without its
+// nodes, to the sidecar file next to the csv
+func WriteProvenance(fileName string, artifact models.Manifest) error {
+	artifact.Nodes = nil
+	final, err := json.MarshalIndent(artifact, "", "	")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ProvenancePath(fileName), final, 0644)
+}
+
+// ReadArtifact loads the header of a manifest or subset. JSON files are
+// read directly, any other file is expected to have a provenance sidecar
+func ReadArtifact(fileName string) (models.Manifest, error) {
+	var artifact models.Manifest
+
+	path := fileName
+	if !strings.HasSuffix(fileName, ".json") {
+		path = ProvenancePath(fileName)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return artifact, fmt.Errorf("no provenance found for %s: %v", fileName, err)
+	}
+
+	err = json.Unmarshal(data, &artifact)
+	if err != nil {
+		return artifact, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	return artifact, nil
+}
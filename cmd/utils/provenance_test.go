@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFileDigest(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"", "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"abc", "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+
+	for _, tt := range tests {
+		got, err := FileDigest(writeFile(t, "data.db", tt.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("FileDigest(%q) = %s, want %s", tt.content, got, tt.want)
+		}
+	}
+
+	if _, err := FileDigest(filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Error("FileDigest() of a missing file succeeded")
+	}
+}
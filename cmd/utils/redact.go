@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// passwordParam matches a password in a key=value connection string or
+// in the query of a connection url
+var passwordParam = regexp.MustCompile(`(?i)(\b(?:ssl)?password\s*=\s*)('[^']*'|[^&\s]+)`)
+
+// RedactDSN removes the credentials from a value that may be a
+// connection string, so it can be recorded. A url loses its userinfo
+// and any password parameter, a key=value string its password. Other
+// values come back unchanged
+func RedactDSN(value string) string {
+	if scheme, rest, ok := strings.Cut(value, "://"); ok && !strings.ContainsAny(scheme, "/ ") {
+		// the userinfo ends at the last @ before the query, a password
+		// may itself hold / or @
+		authority := rest
+		if q := strings.IndexByte(rest, '?'); q >= 0 {
+			authority = rest[:q]
+		}
+		if at := strings.LastIndexByte(authority, '@'); at >= 0 {
+			rest = rest[at+1:]
+		}
+		value = scheme + "://" + rest
+	}
+	return passwordParam.ReplaceAllString(value, "${1}xxxxx")
+}
+
+// RedactParams applies RedactDSN to every recorded flag value
+func RedactParams(params map[string]string) map[string]string {
+	for name, value := range params {
+		params[name] = RedactDSN(value)
+	}
+	return params
+}
@@ -18,17 +18,24 @@ func WriteToCSV(fileName string, data []models.Entry) error {
 	writer := csv.NewWriter(csvFile)
 
 	// Write the header to the file
-	err = writer.Write([]string{"relative_path", "file_extension", "mime_type", "parser_version"})
+	err = writer.Write([]string{"relative_path", "file_extension", "mime_type", "parser_version", "size", "content_hash"})
 	if err != nil {
 		log.Println(err)
 	}
 
 	// Write each row to the file
 	for _, v := range data {
+		// an unknown size is left empty, not written as 0
+		size := ""
+		if v.Size != nil {
+			size = fmt.Sprintf("%d", *v.Size)
+		}
 		row := []string{v.RelativePath,
 			v.FileExtension,
 			v.MimeType,
-			fmt.Sprintf("%d", v.ParserVersion)}
+			fmt.Sprintf("%d", v.ParserVersion),
+			size,
+			v.ContentHash}
 		err := writer.Write(row)
 		if err != nil {
 			log.Println(err)
@@ -32,10 +32,13 @@ var vecolCmd = &cobra.Command{
 	Short: "process content column into vector searchable col",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		vector.ParseColToVec()
+		collection := cmd.Flag("collection").Value.String()
+		vector.ParseColToVec(collection)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(vecolCmd)
+
+	vecolCmd.Flags().String("collection", "", "only update documents of this collection")
 }
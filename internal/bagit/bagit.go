@@ -0,0 +1,265 @@
+package bagit
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"slice/internal/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	Version  = "1.0"
+	Encoding = "UTF-8"
+)
+
+// Options controls how a bag is created from a manifest
+type Options struct {
+	// Root is the directory the manifest's relative paths resolve against
+	Root string
+	// Output is the bag directory, or the tarball when Tar is set
+	Output string
+	Tar    bool
+	// Force overwrites an existing tarball
+	Force bool
+	// Algorithms used for the payload and tag manifests
+	Algorithms []string
+	// Info holds extra bag-info.txt labels, e.g. Source-Organization
+	Info     map[string]string
+	Software string
+}
+
+// newHash returns a hash for the algorithm names RFC 8493 uses in
+// manifest file names
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+}
+
+// encodePath percent-encodes the characters RFC 8493 does not allow
+// verbatim in manifest file paths
+func encodePath(p string) string {
+	p = strings.ReplaceAll(p, "%", "%25")
+	p = strings.ReplaceAll(p, "\r", "%0D")
+	return strings.ReplaceAll(p, "\n", "%0A")
+}
+
+func decodePath(p string) string {
+	p = strings.ReplaceAll(p, "%0D", "\r")
+	p = strings.ReplaceAll(p, "%0A", "\n")
+	return strings.ReplaceAll(p, "%25", "%")
+}
+
+// copyFile copies src to dst and returns its size and the checksum for
+// each algorithm, hashing while copying so every file is read once
+func copyFile(src, dst string, algorithms []string) (int64, map[string]string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, nil, err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer out.Close()
+
+	return hashReader(in, out, algorithms)
+}
+
+// hashFile returns the size and checksums of a file
+func hashFile(path string, algorithms []string) (int64, map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	return hashReader(file, io.Discard, algorithms)
+}
+
+func hashReader(r io.Reader, w io.Writer, algorithms []string) (int64, map[string]string, error) {
+	hashes := make(map[string]hash.Hash, len(algorithms))
+	writers := []io.Writer{w}
+	for _, alg := range algorithms {
+		h, err := newHash(alg)
+		if err != nil {
+			return 0, nil, err
+		}
+		hashes[alg] = h
+		writers = append(writers, h)
+	}
+
+	n, err := io.Copy(io.MultiWriter(writers...), r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	sums := make(map[string]string, len(hashes))
+	for alg, h := range hashes {
+		sums[alg] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	return n, sums, nil
+}
+
+// Create builds a bag containing every entry of the manifest
+func Create(manifest models.Manifest, opts Options) error {
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = []string{"sha256"}
+	}
+
+	bagDir := opts.Output
+	if opts.Tar {
+		if _, err := os.Stat(opts.Output); err == nil && !opts.Force {
+			return fmt.Errorf("%s already exists", opts.Output)
+		}
+		tmp, err := os.MkdirTemp("", "slice-bag-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		bagDir = filepath.Join(tmp, bagName(opts.Output))
+	}
+
+	if _, err := os.Stat(bagDir); err == nil {
+		return fmt.Errorf("%s already exists", bagDir)
+	}
+	if err := os.MkdirAll(filepath.Join(bagDir, "data"), 0755); err != nil {
+		return err
+	}
+
+	// payload manifests, one line per file per algorithm
+	manifests := make(map[string]*strings.Builder, len(opts.Algorithms))
+	for _, alg := range opts.Algorithms {
+		manifests[alg] = &strings.Builder{}
+	}
+
+	// Payload-Oxum counts the files in data/, a path listed twice is
+	// copied once and directories are not payload
+	var octets int64
+	copied := make(map[string]bool)
+	for _, entry := range manifest.Nodes {
+		rel := filepath.Clean(entry.RelativePath)
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("entry %q is outside the dataset root", entry.RelativePath)
+		}
+		rel = filepath.ToSlash(rel)
+		if copied[rel] {
+			continue
+		}
+
+		src := filepath.Join(opts.Root, filepath.FromSlash(rel))
+		if info, err := os.Stat(src); err == nil && info.IsDir() {
+			continue
+		}
+		dst := filepath.Join(bagDir, "data", filepath.FromSlash(rel))
+		n, sums, err := copyFile(src, dst, opts.Algorithms)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %v", rel, err)
+		}
+		octets += n
+		copied[rel] = true
+
+		for _, alg := range opts.Algorithms {
+			fmt.Fprintf(manifests[alg], "%s  %s\n", sums[alg], encodePath("data/"+rel))
+		}
+	}
+
+	tagFiles := []string{"bagit.txt", "bag-info.txt"}
+	files := map[string]string{
+		"bagit.txt":    fmt.Sprintf("BagIt-Version: %s\nTag-File-Character-Encoding: %s\n", Version, Encoding),
+		"bag-info.txt": bagInfo(manifest, opts, octets, len(copied)),
+	}
+	for _, alg := range opts.Algorithms {
+		name := "manifest-" + alg + ".txt"
+		files[name] = manifests[alg].String()
+		tagFiles = append(tagFiles, name)
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(bagDir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	// tag manifests cover every tag file written above
+	for _, alg := range opts.Algorithms {
+		var tagManifest strings.Builder
+		for _, name := range tagFiles {
+			_, sums, err := hashFile(filepath.Join(bagDir, name), []string{alg})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&tagManifest, "%s  %s\n", sums[alg], name)
+		}
+		err := os.WriteFile(filepath.Join(bagDir, "tagmanifest-"+alg+".txt"), []byte(tagManifest.String()), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Tar {
+		return writeTarGz(bagDir, opts.Output)
+	}
+	return nil
+}
+
+// bagName returns the top level directory name used inside a tarball
+func bagName(output string) string {
+	name := filepath.Base(output)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// bagInfo populates bag-info.txt from the manifest metadata
+func bagInfo(manifest models.Manifest, opts Options, octets int64, files int) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Bagging-Date: %s\n", time.Now().Format("2006-01-02"))
+	fmt.Fprintf(&b, "Bag-Software-Agent: %s\n", opts.Software)
+	fmt.Fprintf(&b, "Payload-Oxum: %d.%d\n", octets, files)
+	fmt.Fprintf(&b, "External-Identifier: %s\n", manifest.Name)
+	if manifest.DType != "" {
+		fmt.Fprintf(&b, "External-Description: %s %s created %s\n",
+			manifest.DType, manifest.Name, manifest.DateTime.Format(time.RFC3339))
+	}
+	if p := manifest.Provenance; p != nil {
+		fmt.Fprintf(&b, "Slice-Source-Name: %s\n", p.SourceName)
+		fmt.Fprintf(&b, "Slice-Source-Digest: %s\n", p.SourceDigest)
+	}
+
+	keys := make([]string, 0, len(opts.Info))
+	for k := range opts.Info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s: %s\n", k, opts.Info[k])
+	}
+
+	return b.String()
+}
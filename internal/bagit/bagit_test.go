@@ -0,0 +1,83 @@
+package bagit
+
+import (
+	"os"
+	"path/filepath"
+	"slice/internal/models"
+	"testing"
+)
+
+func TestCreatePayloadOxum(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for rel, content := range map[string]string{"a.txt": "alpha", "sub/b.txt": "bravo"} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(rel)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a.txt is listed twice and sub is a directory
+	nodes := []models.Entry{{RelativePath: "a.txt"}, {RelativePath: "sub"}, {RelativePath: "sub/b.txt"}, {RelativePath: "./a.txt"}}
+	bagDir := filepath.Join(t.TempDir(), "bag")
+	if err := Create(models.Manifest{Name: "test", Nodes: nodes}, Options{Root: root, Output: bagDir}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := readTagFile(filepath.Join(bagDir, "bag-info.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info["Payload-Oxum"]; got != "10.2" {
+		t.Errorf("Payload-Oxum = %q, want %q", got, "10.2")
+	}
+
+	problems, err := Validate(bagDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("Validate() = %q, want a valid bag", problems)
+	}
+}
+
+func TestCreateOutsideRoot(t *testing.T) {
+	nodes := []models.Entry{{RelativePath: "../escape.txt"}}
+	err := Create(models.Manifest{Nodes: nodes}, Options{Root: t.TempDir(), Output: filepath.Join(t.TempDir(), "bag")})
+	if err == nil {
+		t.Error("Create() accepted an entry outside the root")
+	}
+}
+
+func TestCreateExistingTarball(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(t.TempDir(), "bag.tar.gz")
+	if err := os.WriteFile(output, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := models.Manifest{Name: "test", Nodes: []models.Entry{{RelativePath: "a.txt"}}}
+	opts := Options{Root: root, Output: output, Tar: true}
+	if err := Create(manifest, opts); err == nil {
+		t.Fatal("Create() overwrote an existing tarball")
+	}
+	if data, _ := os.ReadFile(output); string(data) != "keep" {
+		t.Fatalf("existing tarball changed to %q", data)
+	}
+
+	opts.Force = true
+	if err := Create(manifest, opts); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := Validate(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("Validate() = %q, want a valid bag", problems)
+	}
+}
@@ -0,0 +1,206 @@
+package bagit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Validate checks a bag directory or tarball against RFC 8493 and
+// returns every problem found. An empty result means the bag is valid
+func Validate(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bagDir := path
+	if !info.IsDir() {
+		tmp, err := os.MkdirTemp("", "slice-bag-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+
+		bagDir, err = extractTar(path, tmp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []string
+
+	declaration, err := readTagFile(filepath.Join(bagDir, "bagit.txt"))
+	if err != nil {
+		return []string{fmt.Sprintf("bagit.txt: %v", err)}, nil
+	}
+	if declaration["BagIt-Version"] == "" {
+		problems = append(problems, "bagit.txt: missing BagIt-Version")
+	}
+	if declaration["Tag-File-Character-Encoding"] == "" {
+		problems = append(problems, "bagit.txt: missing Tag-File-Character-Encoding")
+	}
+
+	payloadManifests, _ := filepath.Glob(filepath.Join(bagDir, "manifest-*.txt"))
+	if len(payloadManifests) == 0 {
+		problems = append(problems, "no payload manifest found")
+	}
+
+	// Every payload file must be listed in every payload manifest
+	payload := make(map[string]bool)
+	var octets int64
+	err = filepath.Walk(filepath.Join(bagDir, "data"), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(bagDir, p)
+		if err != nil {
+			return err
+		}
+		payload[filepath.ToSlash(rel)] = true
+		octets += info.Size()
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("data: %v", err))
+	}
+
+	for _, manifestPath := range payloadManifests {
+		listed, manifestProblems := checkManifest(bagDir, manifestPath)
+		problems = append(problems, manifestProblems...)
+
+		for p := range payload {
+			if !listed[p] {
+				problems = append(problems, fmt.Sprintf("%s: %s is not listed", filepath.Base(manifestPath), p))
+			}
+		}
+	}
+
+	tagManifests, _ := filepath.Glob(filepath.Join(bagDir, "tagmanifest-*.txt"))
+	for _, manifestPath := range tagManifests {
+		_, manifestProblems := checkManifest(bagDir, manifestPath)
+		problems = append(problems, manifestProblems...)
+	}
+
+	if bagInfo, err := readTagFile(filepath.Join(bagDir, "bag-info.txt")); err == nil {
+		if oxum := bagInfo["Payload-Oxum"]; oxum != "" {
+			expected := fmt.Sprintf("%d.%d", octets, len(payload))
+			if oxum != expected {
+				problems = append(problems, fmt.Sprintf("bag-info.txt: Payload-Oxum is %s, payload is %s", oxum, expected))
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	return problems, nil
+}
+
+// checkManifest verifies every checksum in a payload or tag manifest
+// and returns the set of paths it lists
+func checkManifest(bagDir, manifestPath string) (map[string]bool, []string) {
+	name := filepath.Base(manifestPath)
+	algorithm := strings.TrimSuffix(name, ".txt")
+	algorithm = algorithm[strings.Index(algorithm, "-")+1:]
+
+	listed := make(map[string]bool)
+	var problems []string
+
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return listed, []string{fmt.Sprintf("%s: %v", name, err)}
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			problems = append(problems, fmt.Sprintf("%s line %d: expected \"<checksum> <path>\"", name, line))
+			continue
+		}
+		checksum := fields[0]
+		rel := decodePath(strings.TrimLeft(strings.TrimPrefix(text, checksum), " \t"))
+
+		clean := filepath.ToSlash(filepath.Clean(rel))
+		if strings.HasPrefix(clean, "../") || filepath.IsAbs(clean) {
+			problems = append(problems, fmt.Sprintf("%s line %d: %s escapes the bag", name, line, rel))
+			continue
+		}
+		if strings.HasPrefix(name, "manifest-") && !strings.HasPrefix(clean, "data/") {
+			problems = append(problems, fmt.Sprintf("%s line %d: %s is outside data/", name, line, rel))
+		}
+		listed[clean] = true
+
+		_, sums, err := hashFile(filepath.Join(bagDir, filepath.FromSlash(clean)), []string{algorithm})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if !strings.EqualFold(sums[algorithm], checksum) {
+			problems = append(problems, fmt.Sprintf("%s: checksum mismatch for %s", name, clean))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+	}
+
+	return listed, problems
+}
+
+// readTagFile parses "Label: value" lines, joining indented
+// continuation lines onto the previous value
+func readTagFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tags := make(map[string]string)
+	var last string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if last != "" && (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) {
+			tags[last] += " " + strings.TrimSpace(text)
+			continue
+		}
+
+		label, value, ok := strings.Cut(text, ":")
+		if !ok {
+			continue
+		}
+		last = strings.TrimSpace(label)
+		tags[last] = strings.TrimSpace(value)
+	}
+
+	return tags, scanner.Err()
+}
+
+// ParseInfo parses Label=value pairs given on the command line
+func ParseInfo(pairs []string) (map[string]string, error) {
+	info := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		label, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(label) == "" {
+			return nil, fmt.Errorf("invalid bag-info %q, expected Label=value", pair)
+		}
+		info[strings.TrimSpace(label)] = value
+	}
+	return info, nil
+}
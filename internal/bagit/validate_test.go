@@ -0,0 +1,156 @@
+package bagit
+
+import (
+	"os"
+	"path/filepath"
+	"slice/internal/models"
+	"strings"
+	"testing"
+)
+
+// newBag bags two files and returns the bag directory
+func newBag(t *testing.T, tar bool) string {
+	t.Helper()
+
+	root := t.TempDir()
+	files := map[string]string{"a.txt": "alpha", "sub/b.txt": "bravo"}
+	var nodes []models.Entry
+	for rel, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, models.Entry{RelativePath: rel})
+	}
+
+	output := filepath.Join(t.TempDir(), "bag")
+	if tar {
+		output += ".tar.gz"
+	}
+	opts := Options{Root: root, Output: output, Tar: tar, Algorithms: []string{"sha256", "md5"}, Software: "slice test"}
+	if err := Create(models.Manifest{Name: "test", Nodes: nodes}, opts); err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, bagDir string)
+		// want lists a substring of each expected problem, none means valid
+		want []string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "tampered payload",
+			tamper: func(t *testing.T, bagDir string) {
+				writeBagFile(t, bagDir, "data/a.txt", "alphx")
+			},
+			want: []string{"manifest-md5.txt: checksum mismatch for data/a.txt", "manifest-sha256.txt: checksum mismatch for data/a.txt"},
+		},
+		{
+			name: "resized payload",
+			tamper: func(t *testing.T, bagDir string) {
+				writeBagFile(t, bagDir, "data/a.txt", "alpha!")
+			},
+			want: []string{"Payload-Oxum", "checksum mismatch", "checksum mismatch"},
+		},
+		{
+			name: "unlisted payload",
+			tamper: func(t *testing.T, bagDir string) {
+				writeBagFile(t, bagDir, "data/c.txt", "")
+			},
+			want: []string{"Payload-Oxum", "data/c.txt is not listed", "data/c.txt is not listed"},
+		},
+		{
+			name: "missing payload",
+			tamper: func(t *testing.T, bagDir string) {
+				removeBagFile(t, bagDir, "data/sub/b.txt")
+			},
+			want: []string{"Payload-Oxum", "manifest-md5.txt", "manifest-sha256.txt"},
+		},
+		{
+			// tag manifests are optional in RFC 8493
+			name: "missing tagmanifest",
+			tamper: func(t *testing.T, bagDir string) {
+				removeBagFile(t, bagDir, "tagmanifest-sha256.txt")
+				removeBagFile(t, bagDir, "tagmanifest-md5.txt")
+			},
+		},
+		{
+			name: "tampered tag file",
+			tamper: func(t *testing.T, bagDir string) {
+				writeBagFile(t, bagDir, "bag-info.txt", "Payload-Oxum: 10.2\nContact-Name: someone\n")
+			},
+			want: []string{"tagmanifest-md5.txt: checksum mismatch for bag-info.txt", "tagmanifest-sha256.txt: checksum mismatch for bag-info.txt"},
+		},
+		{
+			name: "missing payload manifest",
+			tamper: func(t *testing.T, bagDir string) {
+				removeBagFile(t, bagDir, "manifest-sha256.txt")
+				removeBagFile(t, bagDir, "manifest-md5.txt")
+			},
+			want: []string{"no payload manifest found",
+				"tagmanifest-md5.txt", "tagmanifest-md5.txt", "tagmanifest-sha256.txt", "tagmanifest-sha256.txt"},
+		},
+		{
+			name: "missing declaration",
+			tamper: func(t *testing.T, bagDir string) {
+				removeBagFile(t, bagDir, "bagit.txt")
+			},
+			want: []string{"bagit.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bagDir := newBag(t, false)
+			if tt.tamper != nil {
+				tt.tamper(t, bagDir)
+			}
+
+			problems, err := Validate(bagDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) != len(tt.want) {
+				t.Fatalf("Validate() = %q, want %d problems like %q", problems, len(tt.want), tt.want)
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("problem %d = %q, want one containing %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTarball(t *testing.T) {
+	problems, err := Validate(newBag(t, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("Validate() = %q, want a valid bag", problems)
+	}
+}
+
+func writeBagFile(t *testing.T, bagDir, rel, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(bagDir, filepath.FromSlash(rel)), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func removeBagFile(t *testing.T, bagDir, rel string) {
+	t.Helper()
+	if err := os.Remove(filepath.Join(bagDir, filepath.FromSlash(rel))); err != nil {
+		t.Fatal(err)
+	}
+}
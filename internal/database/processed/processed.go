@@ -0,0 +1,136 @@
+package processed
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slice/internal/models"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Document holds the columns of a documents row needed to decide
+// whether a manifest entry has already been extracted. A NULL
+// extraction_version is unknown and left nil, such a document never
+// counts as processed
+type Document struct {
+	ExtractionVersion *int64
+	ContentHash       string
+}
+
+// isPostgres reports whether source names a postgres db
+func isPostgres(source string) bool {
+	return source == "postgres" || strings.HasPrefix(source, "postgres://") || strings.HasPrefix(source, "postgresql://")
+}
+
+// openSource opens either a local sqlite3 extraction db or a postgres db.
+// The value "postgres" uses the DB_CONN_STRING environmental variable
+func openSource(source string) (*sql.DB, error) {
+	switch {
+	case source == "postgres":
+		dsn := os.Getenv("DB_CONN_STRING")
+		if dsn == "" {
+			return nil, fmt.Errorf("need to have conn string environmental variable set")
+		}
+		return sql.Open("postgres", dsn)
+	case isPostgres(source):
+		return sql.Open("postgres", source)
+	default:
+		if _, err := os.Stat(source); err != nil {
+			return nil, fmt.Errorf("sqlite db not found: %v", err)
+		}
+		return sql.Open("sqlite3", source)
+	}
+}
+
+// Load reads every processed document from the documents table keyed
+// by file_path. When a path was extracted more than once the highest
+// extraction_version is kept, a known version over an unknown one. A collection limits a postgres db to the
+// documents of the sources synced into it, empty reads them all
+func Load(source, collection string) (map[string]Document, error) {
+	if collection != "" && !isPostgres(source) {
+		return nil, fmt.Errorf("a collection needs a postgres db, %s has no sync sources", source)
+	}
+
+	db, err := openSource(source)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := "SELECT file_path, extraction_version, content_hash FROM documents"
+	var args []any
+	if collection != "" {
+		query += " WHERE source_id IN (SELECT id FROM sync_sources WHERE collection = $1)"
+		args = append(args, collection)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents: %v", err)
+	}
+	defer rows.Close()
+
+	docs := make(map[string]Document)
+	for rows.Next() {
+		var path string
+		var version sql.NullInt64
+		var hash sql.NullString
+		if err := rows.Scan(&path, &version, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+
+		doc := Document{ContentHash: hash.String}
+		if version.Valid {
+			doc.ExtractionVersion = &version.Int64
+		}
+		if prev, ok := docs[path]; ok && newerVersion(prev.ExtractionVersion, doc.ExtractionVersion) {
+			continue
+		}
+		docs[path] = doc
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	return docs, nil
+}
+
+// newerVersion reports whether version a should be kept over b
+func newerVersion(a, b *int64) bool {
+	if a == nil || b == nil {
+		return b == nil
+	}
+	return *a > *b
+}
+
+// Filter drops every entry that was already extracted with at least the
+// entry's parser version. If the entry carries a content hash it must
+// also match the extracted document. Only imported inventories carry
+// one, index leaves it empty, so a manifest from index is compared on
+// the version alone. pathPrefix is joined in front of the relative
+// path to match the file_path recorded by TheScribe
+func Filter(entries []models.Entry, docs map[string]Document, pathPrefix string) ([]models.Entry, int) {
+	var kept []models.Entry
+	skipped := 0
+
+	for _, entry := range entries {
+		path := entry.RelativePath
+		if pathPrefix != "" {
+			path = filepath.Join(pathPrefix, path)
+		}
+
+		doc, ok := docs[path]
+		if ok && doc.ExtractionVersion != nil && *doc.ExtractionVersion >= int64(entry.ParserVersion) &&
+			(entry.ContentHash == "" || entry.ContentHash == doc.ContentHash) {
+			skipped++
+			continue
+		}
+		kept = append(kept, entry)
+	}
+
+	return kept, skipped
+}
@@ -0,0 +1,105 @@
+package processed
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"slice/internal/models"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	version := func(v int64) *int64 { return &v }
+	docs := map[string]Document{
+		"a.pdf":        {ExtractionVersion: version(2)},
+		"b.pdf":        {ExtractionVersion: version(1)},
+		"c.pdf":        {ExtractionVersion: version(2), ContentHash: "abc"},
+		"d.pdf":        {ContentHash: "abc"},
+		"/mnt/e/f.pdf": {ExtractionVersion: version(0)},
+	}
+
+	tests := []struct {
+		name       string
+		entry      models.Entry
+		pathPrefix string
+		want       bool
+	}{
+		{"same version", models.Entry{RelativePath: "a.pdf", ParserVersion: 2}, "", false},
+		{"older parser", models.Entry{RelativePath: "a.pdf", ParserVersion: 1}, "", false},
+		{"newer parser", models.Entry{RelativePath: "b.pdf", ParserVersion: 2}, "", true},
+		{"not extracted", models.Entry{RelativePath: "x.pdf"}, "", true},
+		{"hash matches", models.Entry{RelativePath: "c.pdf", ParserVersion: 2, ContentHash: "abc"}, "", false},
+		{"hash differs", models.Entry{RelativePath: "c.pdf", ParserVersion: 2, ContentHash: "def"}, "", true},
+		{"unknown version", models.Entry{RelativePath: "d.pdf", ContentHash: "abc"}, "", true},
+		{"path prefix", models.Entry{RelativePath: "f.pdf"}, "/mnt/e", false},
+		{"missing path prefix", models.Entry{RelativePath: "f.pdf"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, skipped := Filter([]models.Entry{tt.entry}, docs, tt.pathPrefix)
+			if got := len(kept) == 1; got != tt.want || skipped+len(kept) != 1 {
+				t.Errorf("Filter() kept %v, skipped %d, want kept %v", kept, skipped, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "extract.db")
+	db, err := sql.Open("sqlite3", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+        CREATE TABLE documents (file_path TEXT, extraction_version INTEGER, content_hash TEXT);
+        INSERT INTO documents VALUES
+            ('a.pdf', 1, 'old'), ('a.pdf', 3, 'new'), ('a.pdf', 2, 'mid'),
+            ('b.pdf', NULL, 'x'),
+            ('c.pdf', 2, NULL), ('c.pdf', NULL, 'y');
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(source, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := func(v int64) *int64 { return &v }
+	want := map[string]Document{
+		"a.pdf": {ExtractionVersion: version(3), ContentHash: "new"},
+		"b.pdf": {ContentHash: "x"},
+		"c.pdf": {ExtractionVersion: version(2)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, want %v", got, want)
+	}
+
+	// a NULL version is unknown, not version 0
+	kept, _ := Filter([]models.Entry{{RelativePath: "b.pdf"}}, got, "")
+	if len(kept) != 1 {
+		t.Errorf("Filter() skipped a document with no extraction_version")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		collection string
+	}{
+		{"collection on sqlite", filepath.Join(t.TempDir(), "extract.db"), "reports"},
+		{"missing sqlite db", filepath.Join(t.TempDir(), "missing.db"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.source, tt.collection); err == nil {
+				t.Error("Load() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// expectedColumns is the schema the migrations produce, table to
+// column to postgres udt_name
+var expectedColumns = map[string]map[string]string{
+	"documents": {
+		"id":                 "int8",
+		"file_path":          "text",
+		"file_type":          "text",
+		"content":            "text",
+		"content_hash":       "text",
+		"extraction_version": "int8",
+		"urls":               "text",
+		"names":              "text",
+		"tokens":             "text",
+		"places":             "text",
+		"metadata":           "text",
+		"content_tsv":        "tsvector",
+		"deleted_at":         "timestamptz",
+		"source_id":          "int8",
+		"local_id":           "int8",
+		"url_list":           "_text",
+		"name_list":          "_text",
+		"place_list":         "_text",
+		"token_list":         "_text",
+		"metadata_json":      "jsonb",
+		"sync_run_id":        "int8",
+		"canonical_path":     "text",
+	},
+	"document_entities": {
+		"document_id": "int8",
+		"kind":        "text",
+		"value":       "text",
+	},
+	"document_urls": {
+		"document_id": "int8",
+		"url":         "text",
+	},
+	"sync_checkpoints": {
+		"source":     "text",
+		"last_id":    "int8",
+		"updated_at": "timestamptz",
+	},
+	"sync_quarantine": {
+		"source_id": "int8",
+		"local_id":  "int8",
+		"file_path": "text",
+		"error":     "text",
+		"failed_at": "timestamptz",
+		"status":    "text",
+	},
+	"sync_runs": {
+		"id":            "int8",
+		"source":        "text",
+		"target_table":  "text",
+		"host":          "text",
+		"username":      "text",
+		"pid":           "int4",
+		"backend_pid":   "int4",
+		"status":        "text",
+		"started_at":    "timestamptz",
+		"finished_at":   "timestamptz",
+		"source_path":   "text",
+		"source_digest": "text",
+		"version":       "text",
+		"flags":         "jsonb",
+		"written":       "int8",
+		"not_applied":   "int8",
+		"skipped":       "int8",
+		"deleted":       "int8",
+		"error":         "text",
+	},
+	"sync_sources": {
+		"id":         "int8",
+		"name":       "text",
+		"path":       "text",
+		"created_at": "timestamptz",
+		"collection": "text",
+	},
+	"sync_state": {
+		"source":    "text",
+		"last_id":   "int8",
+		"watermark": "text",
+		"synced_at": "timestamptz",
+	},
+}
+
+// expectedIndexes lists the indexes the migrations create
+var expectedIndexes = []string{
+	"documents_content_tsv_idx",
+	"documents_file_path_idx",
+	"documents_content_hash_idx",
+	"documents_source_file_path_key",
+	"documents_source_local_id_idx",
+	"documents_url_list_idx",
+	"documents_name_list_idx",
+	"documents_place_list_idx",
+	"documents_token_list_idx",
+	"documents_metadata_json_idx",
+	"documents_sync_run_id_idx",
+	"documents_canonical_path_idx",
+	"document_urls_url_idx",
+	"document_entities_kind_value_idx",
+	"sync_runs_source_status_idx",
+	"sync_sources_collection_idx",
+}
+
+// Diff compares the live schema with the expected one and returns a
+// line per difference
+func Diff(db *sql.DB) ([]string, error) {
+	actual := make(map[string]map[string]string)
+
+	rows, err := db.Query(`
+        SELECT table_name, column_name, udt_name
+        FROM information_schema.columns
+        WHERE table_schema = current_schema()
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table, column, udt string
+		if err := rows.Scan(&table, &column, &udt); err != nil {
+			return nil, err
+		}
+		if _, ok := expectedColumns[table]; !ok {
+			continue
+		}
+		if actual[table] == nil {
+			actual[table] = make(map[string]string)
+		}
+		actual[table][column] = udt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var diff []string
+	for _, table := range sortedKeys(expectedColumns) {
+		columns := expectedColumns[table]
+		live, ok := actual[table]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("- table %s is missing", table))
+			continue
+		}
+
+		for _, column := range sortedKeys(columns) {
+			udt, ok := live[column]
+			switch {
+			case !ok:
+				diff = append(diff, fmt.Sprintf("- %s.%s %s is missing", table, column, columns[column]))
+			case udt != columns[column]:
+				diff = append(diff, fmt.Sprintf("~ %s.%s is %s, expected %s", table, column, udt, columns[column]))
+			}
+		}
+		for _, column := range sortedKeys(live) {
+			if _, ok := columns[column]; !ok {
+				diff = append(diff, fmt.Sprintf("+ %s.%s %s is not managed by slice", table, column, live[column]))
+			}
+		}
+	}
+
+	for _, index := range expectedIndexes {
+		var exists bool
+		err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL", index).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up index %s: %v", index, err)
+		}
+		if !exists {
+			diff = append(diff, fmt.Sprintf("- index %s is missing", index))
+		}
+	}
+
+	return diff, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,20 @@
+-- documents holds the text TheScribe extracted, content_tsv is filled by vecol
+CREATE TABLE IF NOT EXISTS documents (
+    id BIGINT PRIMARY KEY,
+    file_path TEXT NOT NULL,
+    file_type TEXT,
+    content TEXT,
+    content_hash TEXT,
+    extraction_version BIGINT,
+    urls TEXT,
+    names TEXT,
+    tokens TEXT,
+    places TEXT,
+    metadata TEXT
+);
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS content_tsv TSVECTOR;
+
+CREATE INDEX IF NOT EXISTS documents_content_tsv_idx ON documents USING GIN (content_tsv);
+CREATE INDEX IF NOT EXISTS documents_file_path_idx ON documents (file_path);
+CREATE INDEX IF NOT EXISTS documents_content_hash_idx ON documents (content_hash);
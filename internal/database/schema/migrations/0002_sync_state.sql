@@ -0,0 +1,7 @@
+-- sync_state is the high-water mark of the last sync of each source
+CREATE TABLE IF NOT EXISTS sync_state (
+    source TEXT PRIMARY KEY,
+    last_id BIGINT NOT NULL,
+    watermark TEXT NOT NULL,
+    synced_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+-- deleted_at marks documents removed from their source when sync runs with --delete=tombstone
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
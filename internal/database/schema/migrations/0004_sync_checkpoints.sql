@@ -0,0 +1,6 @@
+-- sync_checkpoints holds the last committed source id of an unfinished sync
+CREATE TABLE IF NOT EXISTS sync_checkpoints (
+    source TEXT PRIMARY KEY,
+    last_id BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
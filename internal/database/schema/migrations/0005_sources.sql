@@ -0,0 +1,30 @@
+-- sync_sources gives every sqlite db a stable identifier so databases
+-- whose ids all start at 1 can be merged into one documents table
+CREATE TABLE IF NOT EXISTS sync_sources (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    path TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Rows synced before sources existed belong to the "legacy" source,
+-- sync the original db with --source-name legacy to keep updating them
+INSERT INTO sync_sources (name) VALUES ('legacy') ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS source_id BIGINT REFERENCES sync_sources (id);
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS local_id BIGINT;
+
+UPDATE documents
+SET source_id = (SELECT id FROM sync_sources WHERE name = 'legacy'), local_id = id
+WHERE source_id IS NULL;
+
+ALTER TABLE documents ALTER COLUMN source_id SET NOT NULL;
+ALTER TABLE documents ALTER COLUMN local_id SET NOT NULL;
+
+-- documents.id is now assigned here, local_id records the source's id
+CREATE SEQUENCE IF NOT EXISTS documents_id_seq OWNED BY documents.id;
+SELECT setval('documents_id_seq', COALESCE((SELECT MAX(id) FROM documents), 0) + 1, false);
+ALTER TABLE documents ALTER COLUMN id SET DEFAULT nextval('documents_id_seq');
+
+CREATE UNIQUE INDEX IF NOT EXISTS documents_source_file_path_key ON documents (source_id, file_path);
+CREATE INDEX IF NOT EXISTS documents_source_local_id_idx ON documents (source_id, local_id);
@@ -0,0 +1,10 @@
+-- sync_quarantine holds source records that failed to write under
+-- --on-error=quarantine until sync --retry-quarantine resends them
+CREATE TABLE IF NOT EXISTS sync_quarantine (
+    source_id BIGINT NOT NULL REFERENCES sync_sources (id),
+    local_id BIGINT NOT NULL,
+    file_path TEXT,
+    error TEXT NOT NULL,
+    failed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (source_id, local_id)
+);
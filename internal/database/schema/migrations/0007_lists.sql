@@ -0,0 +1,27 @@
+-- The urls, names, places and tokens text columns parsed into arrays
+-- by sync, so documents can be found by item without LIKE scans
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS url_list TEXT[];
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS name_list TEXT[];
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS place_list TEXT[];
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS token_list TEXT[];
+
+CREATE INDEX IF NOT EXISTS documents_url_list_idx ON documents USING GIN (url_list);
+CREATE INDEX IF NOT EXISTS documents_name_list_idx ON documents USING GIN (name_list);
+CREATE INDEX IF NOT EXISTS documents_place_list_idx ON documents USING GIN (place_list);
+CREATE INDEX IF NOT EXISTS documents_token_list_idx ON documents USING GIN (token_list);
+
+-- Child tables filled by sync --entity-tables, one row per item
+CREATE TABLE IF NOT EXISTS document_urls (
+    document_id BIGINT NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    PRIMARY KEY (document_id, url)
+);
+CREATE INDEX IF NOT EXISTS document_urls_url_idx ON document_urls (url);
+
+CREATE TABLE IF NOT EXISTS document_entities (
+    document_id BIGINT NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (document_id, kind, value)
+);
+CREATE INDEX IF NOT EXISTS document_entities_kind_value_idx ON document_entities (kind, value);
@@ -0,0 +1,5 @@
+-- metadata_json is the metadata column as jsonb, NULL where the
+-- metadata is not JSON. sync fills it, optionally schema validated
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS metadata_json JSONB;
+
+CREATE INDEX IF NOT EXISTS documents_metadata_json_idx ON documents USING GIN (metadata_json);
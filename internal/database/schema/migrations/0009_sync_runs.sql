@@ -0,0 +1,16 @@
+-- sync_runs records who holds the sync lock of a source so a second
+-- sync can say who it is waiting on, and spot runs that died holding it
+CREATE TABLE IF NOT EXISTS sync_runs (
+    id BIGSERIAL PRIMARY KEY,
+    source TEXT NOT NULL,
+    target_table TEXT NOT NULL,
+    host TEXT,
+    username TEXT,
+    pid INTEGER,
+    backend_pid INTEGER,
+    status TEXT NOT NULL DEFAULT 'running',
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS sync_runs_source_status_idx ON sync_runs (source, status);
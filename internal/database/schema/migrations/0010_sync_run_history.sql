@@ -0,0 +1,15 @@
+-- sync_runs doubles as the audit trail of every sync: what was synced,
+-- by which version with which flags, and what happened to the records
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS source_path TEXT;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS source_digest TEXT;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS version TEXT;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS flags JSONB;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS written BIGINT;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS not_applied BIGINT;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS skipped BIGINT;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS deleted BIGINT;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS error TEXT;
+
+-- sync --stamp-run records the run that last wrote each row
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS sync_run_id BIGINT REFERENCES sync_runs (id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS documents_sync_run_id_idx ON documents (sync_run_id);
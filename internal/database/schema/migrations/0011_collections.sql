@@ -0,0 +1,6 @@
+-- A collection groups the sources of one dataset or investigation so
+-- several can share the documents table. Every source belongs to one,
+-- sources synced before collections existed are in "default"
+ALTER TABLE sync_sources ADD COLUMN IF NOT EXISTS collection TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS sync_sources_collection_idx ON sync_sources (collection);
@@ -0,0 +1,6 @@
+-- canonical_path is file_path after the sync path rules, so the same
+-- file seen under different worker mounts can be joined to manifests.
+-- file_path keeps the original and stays the natural key
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS canonical_path TEXT;
+
+CREATE INDEX IF NOT EXISTS documents_canonical_path_idx ON documents (canonical_path);
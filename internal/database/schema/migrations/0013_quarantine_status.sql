@@ -0,0 +1,3 @@
+-- Records set aside under --on-error=skip are kept too, so the
+-- watermark moving past them does not lose them
+ALTER TABLE sync_quarantine ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'quarantined';
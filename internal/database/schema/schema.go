@@ -0,0 +1,170 @@
+package schema
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one embedded sql file, named <version>_<name>.sql
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Migrations returns every embedded migration ordered by version
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		num, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", entry.Name())
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has an invalid version: %v", entry.Name(), err)
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func ensureMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        )
+    `)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+	return nil
+}
+
+// Applied returns the versions recorded in schema_migrations
+func Applied(db *sql.DB) (map[int]bool, error) {
+	applied := make(map[int]bool)
+
+	var exists bool
+	err := db.QueryRow("SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up schema_migrations: %v", err)
+	}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Pending returns the migrations not yet applied
+func Pending(db *sql.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := Applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// RequireCurrent returns an error naming the pending migrations so
+// commands fail with a clear message instead of a missing column
+func RequireCurrent(db *sql.DB) error {
+	pending, err := Pending(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var names []string
+	for _, m := range pending {
+		names = append(names, fmt.Sprintf("%04d_%s", m.Version, m.Name))
+	}
+	return fmt.Errorf("database schema is out of date, run `slice db migrate` to apply %s", strings.Join(names, ", "))
+}
+
+// Migrate applies every pending migration, each in its own transaction
+func Migrate(db *sql.DB) ([]Migration, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	pending, err := Pending(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range pending {
+		tx, err := db.Begin()
+		if err != nil {
+			return pending[:i], fmt.Errorf("failed to begin transaction: %v", err)
+		}
+
+		if _, err = tx.Exec(m.SQL); err != nil {
+			tx.Rollback()
+			return pending[:i], fmt.Errorf("migration %04d_%s failed: %v", m.Version, m.Name, err)
+		}
+
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+		if err != nil {
+			tx.Rollback()
+			return pending[:i], fmt.Errorf("failed to record migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+
+		if err = tx.Commit(); err != nil {
+			return pending[:i], fmt.Errorf("failed to commit migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+	}
+
+	return pending, nil
+}
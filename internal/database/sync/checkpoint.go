@@ -0,0 +1,171 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// saveCheckpoint records lastID inside the batch transaction so the
+// checkpoint only moves when the batch is committed
+func saveCheckpoint(tx *sql.Tx, source string, lastID int64) error {
+	_, err := tx.Exec(`
+        INSERT INTO sync_checkpoints (source, last_id, updated_at)
+        VALUES ($1, $2, now())
+        ON CONFLICT (source) DO UPDATE
+        SET last_id = EXCLUDED.last_id,
+            updated_at = EXCLUDED.updated_at
+    `, source, lastID)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %v", err)
+	}
+	return nil
+}
+
+// clearCheckpoint removes the checkpoints of source and its worker
+// ranges once a sync completes
+func clearCheckpoint(pgDB *sql.DB, source string) error {
+	_, err := pgDB.Exec("DELETE FROM sync_checkpoints WHERE source = $1 OR starts_with(source, $1 || '#')", source)
+	if err != nil {
+		return fmt.Errorf("failed to clear checkpoint: %v", err)
+	}
+	return nil
+}
+
+// rangeKey is the checkpoint key of one worker's id range. Split
+// ranges are bounded on both sides
+func rangeKey(source string, r idRange) string {
+	return fmt.Sprintf("%s#%d-%d", source, r.After, r.Upto)
+}
+
+// checkpointSpan is what one stored checkpoint marks as committed, the
+// ids after the start of its range up to its last id. The whole source
+// checkpoint starts before every id
+type checkpointSpan struct {
+	key string
+	ids idRange
+}
+
+// loadCheckpoints returns the spans left by an unfinished sync of
+// source, under the whole source key and under every worker range key
+// whatever split wrote them
+func loadCheckpoints(pgDB *sql.DB, source string) ([]checkpointSpan, error) {
+	rows, err := pgDB.Query(`
+        SELECT source, last_id FROM sync_checkpoints
+        WHERE source = $1 OR starts_with(source, $1 || '#')
+        ORDER BY source
+    `, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoints: %v", err)
+	}
+	defer rows.Close()
+
+	var spans []checkpointSpan
+	for rows.Next() {
+		var key string
+		var lastID int64
+		if err := rows.Scan(&key, &lastID); err != nil {
+			return nil, fmt.Errorf("failed to scan checkpoint: %v", err)
+		}
+		if span, ok := parseCheckpoint(source, key, lastID); ok {
+			spans = append(spans, span)
+		}
+	}
+	return spans, rows.Err()
+}
+
+// parseCheckpoint reads the range of a checkpoint back from its key.
+// The quarantine retry's checkpoint covers no range and is left out
+func parseCheckpoint(source, key string, lastID int64) (checkpointSpan, bool) {
+	if key == source {
+		return checkpointSpan{key: key, ids: idRange{}.atMost(lastID)}, true
+	}
+
+	suffix := strings.TrimPrefix(key, source+"#")
+	if suffix == "quarantine" {
+		return checkpointSpan{}, false
+	}
+	var after, upto int64
+	if _, err := fmt.Sscanf(suffix, "%d-%d", &after, &upto); err != nil || rangeKey(source, between(after, upto)) != key {
+		log.Printf("Ignoring checkpoint %s, its key names no id range\n", key)
+		return checkpointSpan{}, false
+	}
+	return checkpointSpan{key: key, ids: between(after, lastID)}, true
+}
+
+// resumePoints moves the start of each range past the ids the spans
+// mark as committed from that start on. Spans chain, so a range split
+// differently from the interrupted sync still skips everything done
+// before its first gap. No ids lie at or below floor, so a range
+// starting lower or open is taken to start there. It also returns the
+// spans holding ids that will be synced again, those past a gap in a
+// range
+func resumePoints(ranges []idRange, spans []checkpointSpan, floor sql.NullInt64) ([]idRange, []checkpointSpan) {
+	resumed := make([]idRange, len(ranges))
+	for i, r := range ranges {
+		start := r
+		if floor.Valid {
+			start = r.above(floor.Int64)
+		}
+		at := start
+		for moved := true; moved; {
+			moved = false
+			for _, s := range spans {
+				// the span starts at or before at and runs past it
+				starts := !s.ids.HasAfter || at.HasAfter && s.ids.After <= at.After
+				if starts && (!at.HasAfter || at.After < s.ids.Upto) {
+					at = at.above(s.ids.Upto)
+					moved = true
+				}
+			}
+		}
+		if at != start {
+			r = at
+		}
+		resumed[i] = r
+	}
+
+	var unused []checkpointSpan
+	for _, s := range spans {
+		for _, r := range resumed {
+			if s.ids.overlaps(r) {
+				unused = append(unused, s)
+				break
+			}
+		}
+	}
+	return resumed, unused
+}
+
+// resumeRanges narrows each range to start after the checkpoints of
+// source when resuming, floor is one below the lowest source id and
+// null for an empty source. Without --resume leftover checkpoints are
+// reported and the ranges are synced from their start
+func resumeRanges(pgDB *sql.DB, source string, ranges []idRange, floor sql.NullInt64, resume bool) ([]idRange, error) {
+	spans, err := loadCheckpoints(pgDB, source)
+	if err != nil || len(spans) == 0 {
+		return ranges, err
+	}
+
+	if !resume {
+		log.Printf("A previous sync of %s stopped partway, starting over, use --resume to continue it\n", source)
+		return ranges, nil
+	}
+
+	resumed, unused := resumePoints(ranges, spans, floor)
+	for i, r := range resumed {
+		if r == ranges[i] {
+			continue
+		}
+		if !r.HasUpto {
+			log.Printf("Resuming %s after id %d\n", source, r.After)
+		} else {
+			log.Printf("Resuming %s %s after id %d\n", source, ranges[i], r.After)
+		}
+	}
+	for _, s := range unused {
+		log.Printf("Warning: checkpoint %s (%s) does not line up with the current ranges, some of its ids will be synced again\n", s.key, s.ids)
+	}
+	return resumed, nil
+}
@@ -0,0 +1,110 @@
+package sync
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestParseCheckpoint(t *testing.T) {
+	tests := []struct {
+		key    string
+		want   checkpointSpan
+		wantOK bool
+	}{
+		{"src", checkpointSpan{key: "src", ids: idRange{Upto: 40, HasUpto: true}}, true},
+		{"src#0-25", checkpointSpan{key: "src#0-25", ids: between(0, 40)}, true},
+		{"src#-1-2", checkpointSpan{key: "src#-1-2", ids: between(-1, 40)}, true},
+		{"src#-9--5", checkpointSpan{key: "src#-9--5", ids: between(-9, 40)}, true},
+		{"src#quarantine", checkpointSpan{}, false},
+		{"src#0-25x", checkpointSpan{}, false},
+		{"src#abc", checkpointSpan{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseCheckpoint("src", tt.key, 40)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("parseCheckpoint(%q) = %v, %v, want %v, %v", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestResumePoints(t *testing.T) {
+	span := func(after, last int64) checkpointSpan {
+		return checkpointSpan{key: rangeKey("src", between(after, last)), ids: between(after, last)}
+	}
+
+	tests := []struct {
+		name       string
+		ranges     []idRange
+		spans      []checkpointSpan
+		floor      sql.NullInt64
+		want       []idRange
+		wantUnused int
+	}{
+		{
+			name:   "same split",
+			ranges: []idRange{between(0, 50), between(50, 100)},
+			spans:  []checkpointSpan{span(0, 20), span(50, 70)},
+			want:   []idRange{between(20, 50), between(70, 100)},
+		},
+		{
+			name:   "single worker after workers",
+			ranges: []idRange{{}},
+			spans:  []checkpointSpan{span(0, 50), span(50, 80)},
+			floor:  sql.NullInt64{Int64: 0, Valid: true},
+			want:   []idRange{{After: 80, HasAfter: true}},
+		},
+		{
+			name:       "single worker stops at a gap",
+			ranges:     []idRange{{}},
+			spans:      []checkpointSpan{span(0, 20), span(50, 70)},
+			floor:      sql.NullInt64{Int64: 0, Valid: true},
+			want:       []idRange{{After: 20, HasAfter: true}},
+			wantUnused: 1,
+		},
+		{
+			name:   "more workers than before",
+			ranges: []idRange{between(0, 25), between(25, 50), between(50, 75), between(75, 100)},
+			spans:  []checkpointSpan{span(0, 40), span(50, 100)},
+			want:   []idRange{between(40, 25), between(40, 50), between(100, 75), between(100, 100)},
+		},
+		{
+			name:   "whole source checkpoint split across workers",
+			ranges: []idRange{between(0, 50), between(50, 100)},
+			spans:  []checkpointSpan{{key: "src", ids: idRange{Upto: 60, HasUpto: true}}},
+			floor:  sql.NullInt64{Int64: 0, Valid: true},
+			want:   []idRange{between(60, 50), between(60, 100)},
+		},
+		{
+			name:   "no checkpoints",
+			ranges: []idRange{between(0, 50)},
+			want:   []idRange{between(0, 50)},
+		},
+		{
+			name:   "negative ids",
+			ranges: []idRange{{}},
+			spans:  []checkpointSpan{span(-11, -3)},
+			floor:  sql.NullInt64{Int64: -11, Valid: true},
+			want:   []idRange{{After: -3, HasAfter: true}},
+		},
+		{
+			name:   "floor does not move an unresumed range",
+			ranges: []idRange{{}},
+			floor:  sql.NullInt64{Int64: 9, Valid: true},
+			want:   []idRange{{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, unused := resumePoints(tt.ranges, tt.spans, tt.floor)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resumePoints() = %v, want %v", got, tt.want)
+			}
+			if len(unused) != tt.wantUnused {
+				t.Errorf("resumePoints() left %d unused spans %v, want %d", len(unused), unused, tt.wantUnused)
+			}
+		})
+	}
+}
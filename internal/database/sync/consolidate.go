@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// sqliteSchema mirrors the postgres documents table closely enough
+// that the same upsert works against it. The list columns hold postgres
+// array literals
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sync_sources (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    path TEXT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS documents (
+    id INTEGER PRIMARY KEY,
+    source_id INTEGER NOT NULL REFERENCES sync_sources (id),
+    local_id INTEGER NOT NULL,
+    file_path TEXT NOT NULL,
+    file_type TEXT,
+    content TEXT,
+    content_hash TEXT,
+    extraction_version INTEGER,
+    urls TEXT,
+    names TEXT,
+    tokens TEXT,
+    places TEXT,
+    metadata TEXT,
+    url_list TEXT,
+    name_list TEXT,
+    place_list TEXT,
+    token_list TEXT,
+    metadata_json TEXT,
+    canonical_path TEXT,
+    deleted_at TEXT,
+    UNIQUE (source_id, file_path)
+);
+
+CREATE INDEX IF NOT EXISTS documents_file_path_idx ON documents (file_path);
+CREATE INDEX IF NOT EXISTS documents_content_hash_idx ON documents (content_hash);
+CREATE INDEX IF NOT EXISTS documents_canonical_path_idx ON documents (canonical_path);
+`
+
+// sqliteDestination consolidates sources into a single sqlite db, for
+// moving extractions without a live postgres. It keeps no sync state,
+// so every sync resends every row
+type sqliteDestination struct {
+	db       *sql.DB
+	conflict string
+}
+
+func openSQLite(path, conflict string) (*sqliteDestination, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite destination: %v", err)
+	}
+
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create SQLite destination schema: %v", err)
+	}
+
+	return &sqliteDestination{db: db, conflict: conflict}, nil
+}
+
+func (d *sqliteDestination) RegisterSource(name, path string) (int64, error) {
+	return registerSource(d.db, name, path)
+}
+
+func (d *sqliteDestination) WriteBatch(sourceID int64, records []Record, key string) ([]int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+
+	unapplied, err := rowWriter{sourceID: sourceID, conflict: d.conflict}.writeBatch(tx, records)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit batch: %w", err)
+	}
+	return unapplied, nil
+}
+
+func (d *sqliteDestination) Close() error {
+	return d.db.Close()
+}
@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DELETE_NONE      = "none"
+	DELETE_HARD      = "hard"
+	DELETE_TOMBSTONE = "tombstone"
+)
+
+// maxRangesShown caps how many id ranges the deletion summary prints
+const maxRangesShown = 50
+
+// findDeleted returns the documents ids and local ids of live remote
+// rows of the source whose path is not among the source's paths,
+// sorted by local id, and the number of live remote rows of the
+// source. paths comes from readPaths, so the mapping's transform and
+// the sanitizer apply as they do to the rows written
+func findDeleted(paths map[string]int64, sourceID int64, pgDB *sql.DB) ([]int64, []int64, int, error) {
+	rows, err := pgDB.Query(`
+        SELECT id, local_id, file_path FROM documents
+        WHERE source_id = $1 AND deleted_at IS NULL
+        ORDER BY local_id
+    `, sourceID)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to query PostgreSQL: %v", err)
+	}
+	defer rows.Close()
+
+	var ids, localIDs []int64
+	remote := 0
+	for rows.Next() {
+		var id, localID int64
+		var path string
+		if err := rows.Scan(&id, &localID, &path); err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to scan row: %v", err)
+		}
+		remote++
+		if _, ok := paths[path]; !ok {
+			ids = append(ids, id)
+			localIDs = append(localIDs, localID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, 0, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	return ids, localIDs, remote, nil
+}
+
+// checkDeleteThreshold refuses to continue when more than maxPct
+// percent of the remote rows would be deleted
+func checkDeleteThreshold(deleted []int64, remote int, maxPct float64) error {
+	if remote == 0 || len(deleted) == 0 {
+		return nil
+	}
+
+	pct := float64(len(deleted)) / float64(remote) * 100
+	if pct > maxPct {
+		return fmt.Errorf("refusing to delete %d of %d rows (%.1f%%), above the %.1f%% threshold, raise --max-delete-pct to proceed",
+			len(deleted), remote, pct, maxPct)
+	}
+	return nil
+}
+
+// applyDeletes hard deletes or tombstones the documents ids in batches
+func applyDeletes(pgDB *sql.DB, ids []int64, mode string, batchSize int) error {
+	var query string
+	switch mode {
+	case DELETE_HARD:
+		query = "DELETE FROM documents WHERE id = ANY($1)"
+	case DELETE_TOMBSTONE:
+		query = "UPDATE documents SET deleted_at = now() WHERE id = ANY($1) AND deleted_at IS NULL"
+	default:
+		return fmt.Errorf("unknown delete mode %q", mode)
+	}
+
+	for start := 0; start < len(ids); start += batchSize {
+		end := min(start+batchSize, len(ids))
+		if _, err := pgDB.Exec(query, pq.Array(ids[start:end])); err != nil {
+			return fmt.Errorf("failed to delete ids %d-%d: %v", ids[start], ids[end-1], err)
+		}
+	}
+	return nil
+}
+
+// formatIDRanges collapses sorted ids into ranges, e.g. "1-4, 7, 9-10"
+func formatIDRanges(ids []int64) string {
+	var ranges []string
+	for i := 0; i < len(ids); {
+		j := i
+		for j+1 < len(ids) && ids[j+1] == ids[j]+1 {
+			j++
+		}
+
+		if len(ranges) == maxRangesShown {
+			ranges = append(ranges, "...")
+			break
+		}
+		if i == j {
+			ranges = append(ranges, fmt.Sprintf("%d", ids[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", ids[i], ids[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
@@ -0,0 +1,129 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openTestRemote creates a documents table holding the rows of source
+// 1 as path: local id, with a tombstone and a row of another source
+func openTestRemote(t *testing.T, rows map[string]int64) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "remote.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+        CREATE TABLE documents (id INTEGER PRIMARY KEY, source_id INTEGER, local_id INTEGER, file_path TEXT, deleted_at TEXT);
+        INSERT INTO documents (source_id, local_id, file_path, deleted_at) VALUES
+            (1, 90, 'tombstoned.txt', '2025-01-01'),
+            (2, 91, 'other-source.txt', NULL);
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, localID := range rows {
+		_, err := db.Exec("INSERT INTO documents (id, source_id, local_id, file_path) VALUES (?, 1, ?, ?)", localID+100, localID, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestFindDeleted(t *testing.T) {
+	tests := []struct {
+		name         string
+		remote       map[string]int64
+		paths        map[string]int64
+		wantIDs      []int64
+		wantLocalIDs []int64
+		wantRemote   int
+	}{
+		{"nothing synced", nil, map[string]int64{"a": 1}, nil, nil, 0},
+		{"nothing deleted", map[string]int64{"a": 1, "b": 2}, map[string]int64{"a": 1, "b": 2}, nil, nil, 2},
+		{"deleted in local id order", map[string]int64{"a": 1, "b": 2, "c": 3}, map[string]int64{"b": 2}, []int64{101, 103}, []int64{1, 3}, 3},
+		{"empty source", map[string]int64{"a": 1, "b": 2}, map[string]int64{}, []int64{101, 102}, []int64{1, 2}, 2},
+		// a re-extraction renumbered the ids, the paths are the same
+		{"renumbered", map[string]int64{"a": 1, "b": 2}, map[string]int64{"a": 7, "b": 8}, nil, nil, 2},
+		{"renamed", map[string]int64{"a": 1}, map[string]int64{"A": 1}, []int64{101}, []int64{1}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, localIDs, remote, err := findDeleted(tt.paths, 1, openTestRemote(t, tt.remote))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || !reflect.DeepEqual(localIDs, tt.wantLocalIDs) || remote != tt.wantRemote {
+				t.Errorf("findDeleted() = %v, %v, %d, want %v, %v, %d", ids, localIDs, remote, tt.wantIDs, tt.wantLocalIDs, tt.wantRemote)
+			}
+		})
+	}
+}
+
+func TestCheckDeleteThreshold(t *testing.T) {
+	ids := func(n int) []int64 { return make([]int64, n) }
+
+	tests := []struct {
+		name    string
+		deleted []int64
+		remote  int
+		maxPct  float64
+		wantErr bool
+	}{
+		{"nothing remote", nil, 0, 10, false},
+		{"nothing deleted", nil, 100, 0, false},
+		{"below", ids(9), 100, 10, false},
+		{"exactly at the threshold", ids(10), 100, 10, false},
+		{"above", ids(11), 100, 10, true},
+		{"zero threshold", ids(1), 100, 0, true},
+		{"everything", ids(5), 5, 100, false},
+		{"everything below 100", ids(5), 5, 99.9, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDeleteThreshold(tt.deleted, tt.remote, tt.maxPct)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkDeleteThreshold(%d of %d, %.1f) = %v, want error %v", len(tt.deleted), tt.remote, tt.maxPct, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormatIDRanges(t *testing.T) {
+	many := make([]int64, 0, maxRangesShown+1)
+	var want []string
+	for i := range maxRangesShown + 1 {
+		many = append(many, int64(i*2))
+		want = append(want, fmt.Sprintf("%d", i*2))
+	}
+	want = append(want[:maxRangesShown], "...")
+
+	tests := []struct {
+		name string
+		ids  []int64
+		want string
+	}{
+		{"none", nil, ""},
+		{"single", []int64{7}, "7"},
+		{"ranges and singles", []int64{1, 2, 3, 4, 7, 9, 10}, "1-4, 7, 9-10"},
+		{"exactly the cap", many[:maxRangesShown], strings.Join(want[:maxRangesShown], ", ")},
+		{"over the cap", many, strings.Join(want, ", ")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatIDRanges(tt.ids); got != tt.want {
+				t.Errorf("formatIDRanges(%v) = %q, want %q", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"slice/internal/database/schema"
+	"strings"
+)
+
+// Destination receives the sanitized batches read from a source
+type Destination interface {
+	// RegisterSource returns the id the rows of the named source are
+	// written under
+	RegisterSource(name, path string) (int64, error)
+	// WriteBatch writes one batch of a source and returns the ids of
+	// the records the conflict strategy did not apply. Destinations
+	// that keep checkpoints record the last id of the batch under key
+	WriteBatch(sourceID int64, records []Record, key string) ([]int64, error)
+	Close() error
+}
+
+// incrementalDestination is implemented by destinations that keep sync
+// state. Incremental syncs, deletions, dry runs, resume and workers all
+// read that state, so they are only available on these
+type incrementalDestination interface {
+	Destination
+	remote() *sql.DB
+	// forRun returns the destination stamping the rows it writes with
+	// a sync_runs id
+	forRun(runID int64) incrementalDestination
+}
+
+// openDestination opens the destination named by config.Dest. An empty
+// value or "postgres" uses config.PostgresDSN, a postgres:// url is
+// used as the DSN, a .jsonl file is an export and anything else is a
+// sqlite db to consolidate into
+func openDestination(config Config) (Destination, error) {
+	dest := config.Dest
+	switch {
+	case dest == "" || dest == "postgres":
+		return openPostgres(config.PostgresDSN, config)
+	case strings.HasPrefix(dest, "postgres://"), strings.HasPrefix(dest, "postgresql://"):
+		return openPostgres(dest, config)
+	case strings.EqualFold(filepath.Ext(dest), ".jsonl"):
+		return openJSONL(dest, config.RetryQuarantine)
+	case strings.EqualFold(filepath.Ext(dest), ".parquet"):
+		return nil, fmt.Errorf("parquet export is not supported, use a .jsonl destination")
+	default:
+		return openSQLite(dest, config.Conflict)
+	}
+}
+
+// postgresDestination upserts into the documents table with the
+// configured write method and keeps sync state alongside it
+type postgresDestination struct {
+	db       *sql.DB
+	method   string
+	conflict string
+	entities bool
+	runID    int64
+	// collection new sources are put in, empty keeps their own
+	collection string
+}
+
+func openPostgres(dsn string, config Config) (*postgresDestination, error) {
+	if _, err := newBatchWriter(config.Method, 0, config.Conflict, config.EntityTables, 0); err != nil {
+		return nil, err
+	}
+
+	pgDB, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %v", err)
+	}
+
+	if err = pgDB.Ping(); err != nil {
+		pgDB.Close()
+		return nil, fmt.Errorf("PostgreSQL ping failed: %v", err)
+	}
+
+	if err = schema.RequireCurrent(pgDB); err != nil {
+		pgDB.Close()
+		return nil, err
+	}
+
+	return &postgresDestination{db: pgDB, method: config.Method, conflict: config.Conflict, entities: config.EntityTables,
+		collection: config.Collection}, nil
+}
+
+func (d *postgresDestination) RegisterSource(name, path string) (int64, error) {
+	id, err := registerSource(d.db, name, path)
+	if err != nil {
+		return 0, err
+	}
+	return id, claimCollection(d.db, id, name, d.collection)
+}
+
+func (d *postgresDestination) WriteBatch(sourceID int64, records []Record, key string) ([]int64, error) {
+	writer, err := newBatchWriter(d.method, sourceID, d.conflict, d.entities, d.runID)
+	if err != nil {
+		return nil, err
+	}
+	return commitBatch(d.db, writer, records, key)
+}
+
+func (d *postgresDestination) Close() error {
+	return d.db.Close()
+}
+
+func (d *postgresDestination) remote() *sql.DB {
+	return d.db
+}
+
+func (d *postgresDestination) forRun(runID int64) incrementalDestination {
+	run := *d
+	run.runID = runID
+	return &run
+}
@@ -0,0 +1,148 @@
+package sync
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenDestination(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		dest    string
+		want    string
+		wantErr bool
+	}{
+		{filepath.Join(dir, "export.jsonl"), "*sync.jsonlDestination", false},
+		{filepath.Join(dir, "EXPORT.JSONL"), "*sync.jsonlDestination", false},
+		{filepath.Join(dir, "merged.db"), "*sync.sqliteDestination", false},
+		{filepath.Join(dir, "export.parquet"), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.dest), func(t *testing.T) {
+			dest, err := openDestination(Config{Dest: tt.dest, Conflict: CONFLICT_SOURCE_WINS})
+			if tt.wantErr {
+				if err == nil {
+					dest.Close()
+					t.Fatal("openDestination() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dest.Close()
+
+			if got := reflect.TypeOf(dest).String(); got != tt.want {
+				t.Errorf("openDestination() = %s, want %s", got, tt.want)
+			}
+			// file destinations keep no sync state
+			if isIncremental(dest) {
+				t.Errorf("%s is incremental", tt.want)
+			}
+		})
+	}
+}
+
+// readExport returns the rows of a jsonl export
+func readExport(t *testing.T, path string) []map[string]any {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var rows []map[string]any
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var row map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("line %q is not json: %v", scanner.Text(), err)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestJSONLDestination(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.jsonl")
+	metadata := `{"a": 1}`
+
+	export := func(appendRows bool, records map[string][]Record) {
+		t.Helper()
+		dest, err := openJSONL(path, appendRows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"reports", "memos"} {
+			id, err := dest.RegisterSource(name, name+".db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := dest.WriteBatch(id, records[name], ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := dest.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record := Record{ID: 1, FilePath: "a.txt", Content: "a\x00b", Metadata: &metadata, UrlList: []string{"https://a.org"}}
+	export(false, map[string][]Record{"reports": {record}, "memos": {{ID: 2, FilePath: "b.txt"}}})
+
+	rows := readExport(t, path)
+	if len(rows) != 2 {
+		t.Fatalf("export has %d rows, want 2", len(rows))
+	}
+	first := rows[0]
+	want := map[string]any{"source": "reports", "local_id": 1.0, "file_path": "a.txt", "content": "ab", "metadata": metadata}
+	for key, value := range want {
+		if first[key] != value {
+			t.Errorf("%s = %v, want %v", key, first[key], value)
+		}
+	}
+	if got := first["url_list"]; !reflect.DeepEqual(got, []any{"https://a.org"}) {
+		t.Errorf("url_list = %v, want the parsed list", got)
+	}
+	for _, key := range []string{"source_id", "metadata_json"} {
+		if _, ok := first[key]; ok {
+			t.Errorf("export has %s", key)
+		}
+	}
+	if rows[1]["source"] != "memos" {
+		t.Errorf("second source = %v, want memos", rows[1]["source"])
+	}
+
+	// a quarantine retry appends, a new export starts over
+	export(true, map[string][]Record{"memos": {{ID: 3, FilePath: "c.txt"}}})
+	if n := len(readExport(t, path)); n != 3 {
+		t.Errorf("appended export has %d rows, want 3", n)
+	}
+	export(false, nil)
+	if data, _ := os.ReadFile(path); strings.TrimSpace(string(data)) != "" {
+		t.Errorf("new export kept %q", data)
+	}
+}
+
+func TestSQLiteDestinationRegisterSource(t *testing.T) {
+	dest, first := openTestDest(t, CONFLICT_SOURCE_WINS)
+
+	again, err := dest.RegisterSource("src", "moved/src.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := dest.RegisterSource("other", "other.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first || other == first {
+		t.Errorf("RegisterSource() ids = %d, %d, %d, want the same id for the same name only", first, again, other)
+	}
+}
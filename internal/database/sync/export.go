@@ -0,0 +1,71 @@
+package sync
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// jsonlDestination exports every row as one json object per line with
+// the same columns as documents, naming the source instead of its id
+type jsonlDestination struct {
+	file    *os.File
+	w       *bufio.Writer
+	sources []string
+}
+
+// openJSONL truncates the export unless appendRows is set, which a
+// quarantine retry uses to add its records to the earlier export
+func openJSONL(path string, appendRows bool) (*jsonlDestination, error) {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendRows {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export file: %v", err)
+	}
+	return &jsonlDestination{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// RegisterSource numbers sources in the order they are exported
+func (d *jsonlDestination) RegisterSource(name, path string) (int64, error) {
+	d.sources = append(d.sources, name)
+	return int64(len(d.sources)), nil
+}
+
+// WriteBatch appends every record, an export has nothing to conflict with
+func (d *jsonlDestination) WriteBatch(sourceID int64, records []Record, key string) ([]int64, error) {
+	enc := json.NewEncoder(d.w)
+	for i := range records {
+		values := recordValues(sourceID, &records[i])
+
+		row := make(map[string]any, len(documentColumns))
+		for j, col := range documentColumns {
+			row[col] = values[j]
+		}
+		delete(row, "source_id")
+		// metadata already carries the same json
+		delete(row, "metadata_json")
+		row["source"] = d.sources[sourceID-1]
+
+		if err := enc.Encode(row); err != nil {
+			return nil, fmt.Errorf("failed to export record %d: %v", records[i].ID, err)
+		}
+	}
+
+	// flush per batch so an interrupted export ends on a whole batch
+	if err := d.w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write export file: %v", err)
+	}
+	return nil, nil
+}
+
+func (d *jsonlDestination) Close() error {
+	if err := d.w.Flush(); err != nil {
+		d.file.Close()
+		return err
+	}
+	return d.file.Close()
+}
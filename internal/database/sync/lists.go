@@ -0,0 +1,161 @@
+package sync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// listDelimiters are tried in order when the delimiter is detected
+var listDelimiters = []string{"\n", ";", "|", ","}
+
+// entityDelimiters are detected in names and places. A comma is left
+// out, "Smith, John" is one name, it needs --list-delimiter ,
+var entityDelimiters = []string{"\n", ";", "|"}
+
+// urlDelimiters split a urls value on one line only when every piece
+// is a URL, a comma or semicolon can be part of one
+var urlDelimiters = []string{";", ","}
+
+// parseList splits a urls, names, places or tokens value into its
+// items. A JSON array is decoded, anything else is split on delimiter,
+// or on the first of detect it contains when delimiter is empty. Text
+// with none of them is one item, or split on whitespace when words is
+// set. Items are trimmed and empty or repeated items dropped
+func parseList(value *string, delimiter string, detect []string, words bool) []string {
+	if value == nil {
+		return nil
+	}
+	text := strings.TrimSpace(*value)
+	if text == "" {
+		return nil
+	}
+
+	var items []string
+	if strings.HasPrefix(text, "[") {
+		var decoded []any
+		if err := json.Unmarshal([]byte(text), &decoded); err == nil {
+			for _, item := range decoded {
+				switch v := item.(type) {
+				case nil:
+				case string:
+					items = append(items, v)
+				default:
+					data, _ := json.Marshal(v)
+					items = append(items, string(data))
+				}
+			}
+			return uniqueItems(items)
+		}
+	}
+
+	if delimiter == "" {
+		for _, d := range detect {
+			if strings.Contains(text, d) {
+				delimiter = d
+				break
+			}
+		}
+	}
+	if delimiter == "" {
+		if words {
+			return uniqueItems(strings.Fields(text))
+		}
+		return []string{text}
+	}
+	return uniqueItems(strings.Split(text, delimiter))
+}
+
+// parseURLs splits a urls value like parseList, detecting only
+// newlines, then tries urlDelimiters on a single line
+func parseURLs(value *string, delimiter string) []string {
+	items := parseList(value, delimiter, []string{"\n"}, false)
+	if delimiter != "" || len(items) != 1 {
+		return items
+	}
+
+	for _, d := range urlDelimiters {
+		pieces := strings.Split(items[0], d)
+		if len(pieces) > 1 && allURLs(pieces) {
+			return uniqueItems(pieces)
+		}
+	}
+	return items
+}
+
+// allURLs reports whether every piece is an absolute URL with a host,
+// empty pieces from a trailing delimiter aside
+func allURLs(pieces []string) bool {
+	for _, piece := range pieces {
+		piece = strings.TrimSpace(piece)
+		if piece == "" {
+			continue
+		}
+		u, err := url.Parse(piece)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func uniqueItems(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	var out []string
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		out = append(out, item)
+	}
+	return out
+}
+
+// parseLists fills the list fields of a record from its text fields.
+// Tokens are single words, so a plain token string splits on spaces
+func parseLists(record *Record, delimiter string) {
+	record.UrlList = parseURLs(record.Urls, delimiter)
+	record.NameList = parseList(record.Names, delimiter, entityDelimiters, false)
+	record.PlaceList = parseList(record.Places, delimiter, entityDelimiters, false)
+	record.TokenList = parseList(record.Tokens, delimiter, listDelimiters, true)
+}
+
+// refreshEntities rebuilds the document_urls and document_entities
+// rows of the written records from their list columns
+func refreshEntities(tx *sql.Tx, sourceID int64, records []Record) error {
+	// rows are found by their key, a path as the upsert stored it
+	paths := make([]string, len(records))
+	for i := range records {
+		paths[i] = sanitizeString(records[i].FilePath)
+	}
+
+	statements := []string{
+		`DELETE FROM document_urls WHERE document_id IN
+            (SELECT id FROM documents WHERE source_id = $1 AND file_path = ANY($2))`,
+		`DELETE FROM document_entities WHERE document_id IN
+            (SELECT id FROM documents WHERE source_id = $1 AND file_path = ANY($2))`,
+		`INSERT INTO document_urls (document_id, url)
+            SELECT d.id, u FROM documents d, unnest(d.url_list) u
+            WHERE d.source_id = $1 AND d.file_path = ANY($2)
+            ON CONFLICT DO NOTHING`,
+		`INSERT INTO document_entities (document_id, kind, value)
+            SELECT d.id, 'name', v FROM documents d, unnest(d.name_list) v
+            WHERE d.source_id = $1 AND d.file_path = ANY($2)
+            UNION
+            SELECT d.id, 'place', v FROM documents d, unnest(d.place_list) v
+            WHERE d.source_id = $1 AND d.file_path = ANY($2)
+            ON CONFLICT DO NOTHING`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, sourceID, pq.Array(paths)); err != nil {
+			return fmt.Errorf("failed to refresh entity tables: %v", err)
+		}
+	}
+	return nil
+}
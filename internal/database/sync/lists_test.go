@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name      string
+		value     *string
+		delimiter string
+		detect    []string
+		words     bool
+		want      []string
+	}{
+		{"nil", nil, "", listDelimiters, false, nil},
+		{"blank", str("  "), "", listDelimiters, false, nil},
+		{"json array", str(`["a", "b", null, 3, "a"]`), "", listDelimiters, false, []string{"a", "b", "3"}},
+		{"bad json is text", str("[a; b"), "", listDelimiters, false, []string{"[a", "b"}},
+		{"newlines first", str("a, b\nc; d"), "", listDelimiters, false, []string{"a, b", "c; d"}},
+		{"semicolons", str("a; b ;c"), "", listDelimiters, false, []string{"a", "b", "c"}},
+		{"pipes", str("a|b"), "", listDelimiters, false, []string{"a", "b"}},
+		{"name with comma stays whole", str("Smith, John"), "", entityDelimiters, false, []string{"Smith, John"}},
+		{"names with commas on semicolons", str("Smith, John; Doe, Jane"), "", entityDelimiters, false, []string{"Smith, John", "Doe, Jane"}},
+		{"explicit comma for names", str("Paris, Rome"), ",", entityDelimiters, false, []string{"Paris", "Rome"}},
+		{"explicit delimiter wins", str("a;b|c"), "|", listDelimiters, false, []string{"a;b", "c"}},
+		{"single item", str("Paris"), "", entityDelimiters, false, []string{"Paris"}},
+		{"words", str("alpha beta  alpha"), "", listDelimiters, true, []string{"alpha", "beta"}},
+		{"words prefer a delimiter", str("a b, c"), "", listDelimiters, true, []string{"a b", "c"}},
+		{"empty items dropped", str("a;;b; "), "", listDelimiters, false, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseList(tt.value, tt.delimiter, tt.detect, tt.words)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseURLs(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name      string
+		value     *string
+		delimiter string
+		want      []string
+	}{
+		{"nil", nil, "", nil},
+		{"single", str("https://example.com/a"), "", []string{"https://example.com/a"}},
+		{"newlines", str("https://a.org/x,y\nhttps://b.org"), "", []string{"https://a.org/x,y", "https://b.org"}},
+		{"json array", str(`["https://a.org/?q=1,2", "https://b.org"]`), "", []string{"https://a.org/?q=1,2", "https://b.org"}},
+		{"commas between urls", str("https://a.org, https://b.org,"), "", []string{"https://a.org", "https://b.org"}},
+		{"semicolons between urls", str("https://a.org;https://b.org"), "", []string{"https://a.org", "https://b.org"}},
+		{"comma inside a url", str("https://a.org/?tags=x,y"), "", []string{"https://a.org/?tags=x,y"}},
+		{"semicolon inside a url", str("https://a.org/p;v=1"), "", []string{"https://a.org/p;v=1"}},
+		{"mixed pieces stay whole", str("https://a.org/x, see also"), "", []string{"https://a.org/x, see also"}},
+		{"explicit delimiter wins", str("https://a.org/?q=a|b"), "|", []string{"https://a.org/?q=a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseURLs(tt.value, tt.delimiter)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseURLs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"os/user"
+	"time"
+)
+
+// TARGET_TABLE is the table sync writes to, part of the lock key
+const TARGET_TABLE = "documents"
+
+// lockPollInterval is how often a waiting sync retries the lock
+const lockPollInterval = 5 * time.Second
+
+// idleHolderAfter is how long the holder's connection can sit idle
+// before it is reported as possibly hung
+const idleHolderAfter = 10 * time.Minute
+
+// syncLock is a session advisory lock on one source of a table. Session
+// locks belong to a connection, so it keeps one out of the pool until
+// released
+type syncLock struct {
+	conn  *sql.Conn
+	key   int64
+	runID int64
+}
+
+// lockKey hashes the target table and source name into an advisory
+// lock key
+func lockKey(table, source string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(table + "\x00" + source))
+	return int64(h.Sum64())
+}
+
+// acquireLock takes the sync lock of run.Source and records the run in
+// sync_runs. Without wait it fails straight away when another sync
+// holds the lock, with wait it polls until the lock is free
+func acquireLock(pgDB *sql.DB, run runInfo, wait bool) (*syncLock, error) {
+	source := run.Source
+	ctx := context.Background()
+	conn, err := pgDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a connection for the sync lock: %v", err)
+	}
+
+	key := lockKey(TARGET_TABLE, source)
+	waiting := false
+	for {
+		var ok bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to take the sync lock: %v", err)
+		}
+		if ok {
+			break
+		}
+
+		holder, err := describeHolder(ctx, conn, source, key)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if !wait {
+			conn.Close()
+			return nil, fmt.Errorf("source %s is already being synced into %s by %s, use --wait to wait for it", source, TARGET_TABLE, holder)
+		}
+		if !waiting {
+			log.Printf("Waiting for the sync of source %s by %s", source, holder)
+			waiting = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	lock := &syncLock{conn: conn, key: key}
+
+	// Holding the lock means any run still marked running lost its
+	// connection without finishing
+	if err := markAbandoned(ctx, conn, source); err != nil {
+		lock.release(runCounts{}, err)
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	username := ""
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	flags, err := json.Marshal(run.Flags)
+	if err != nil {
+		lock.release(runCounts{}, err)
+		return nil, err
+	}
+	err = conn.QueryRowContext(ctx, `
+        INSERT INTO sync_runs (source, target_table, host, username, pid, backend_pid,
+                               source_path, source_digest, version, flags)
+        VALUES ($1, $2, $3, $4, $5, pg_backend_pid(), $6, $7, $8, $9)
+        RETURNING id
+    `, source, TARGET_TABLE, host, username, os.Getpid(), run.Path, run.Digest, run.Version, string(flags)).Scan(&lock.runID)
+	if err != nil {
+		lock.release(runCounts{}, err)
+		return nil, fmt.Errorf("failed to record sync run: %v", err)
+	}
+
+	return lock, nil
+}
+
+// describeHolder names the sync holding the lock from its sync_runs
+// row, and warns when the holding connection looks hung
+func describeHolder(ctx context.Context, conn *sql.Conn, source string, key int64) (string, error) {
+	// advisory bigint keys show in pg_locks split over classid and objid
+	var pid sql.NullInt64
+	var state sql.NullString
+	var idle sql.NullFloat64
+	err := conn.QueryRowContext(ctx, `
+        SELECT l.pid, a.state, EXTRACT(EPOCH FROM now() - a.state_change)
+        FROM pg_locks l
+        LEFT JOIN pg_stat_activity a ON a.pid = l.pid
+        WHERE l.locktype = 'advisory' AND l.granted AND l.objsubid = 1
+          AND l.classid = (($1::bigint >> 32) & 4294967295)::oid
+          AND l.objid = ($1::bigint & 4294967295)::oid
+        LIMIT 1
+    `, key).Scan(&pid, &state, &idle)
+	if err == sql.ErrNoRows {
+		// released between the attempt and this query
+		return "another sync that just finished", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the sync lock holder: %v", err)
+	}
+
+	var host, username sql.NullString
+	var clientPid sql.NullInt64
+	var started time.Time
+	err = conn.QueryRowContext(ctx, `
+        SELECT host, username, pid, started_at FROM sync_runs
+        WHERE source = $1 AND status = 'running' AND backend_pid = $2
+        ORDER BY started_at DESC
+        LIMIT 1
+    `, source, pid.Int64).Scan(&host, &username, &clientPid, &started)
+
+	var holder string
+	switch {
+	case err == sql.ErrNoRows:
+		holder = describeRun(pid.Int64, nil)
+	case err != nil:
+		return "", fmt.Errorf("failed to look up the sync lock holder: %v", err)
+	default:
+		holder = describeRun(pid.Int64, &holderRun{username: username.String, host: host.String, pid: clientPid.Int64, started: started})
+	}
+
+	if hung := idleFor(state.String, idle); hung > 0 {
+		log.Printf("The lock holder's connection (backend %d) has been idle for %s and may be hung, "+
+			"SELECT pg_terminate_backend(%d) releases the lock", pid.Int64, hung, pid.Int64)
+	}
+	return holder, nil
+}
+
+// holderRun is the sync_runs row of the sync holding a lock
+type holderRun struct {
+	username, host string
+	pid            int64
+	started        time.Time
+}
+
+// describeRun names the holder of a lock by its run, nil when the
+// holding postgres backend recorded none
+func describeRun(backend int64, run *holderRun) string {
+	if run == nil {
+		return fmt.Sprintf("postgres backend %d (no sync run recorded)", backend)
+	}
+	return fmt.Sprintf("%s@%s pid %d, running since %s", run.username, run.host, run.pid, run.started.Local().Format(time.RFC3339))
+}
+
+// idleFor returns how long the holder's connection has been idle when
+// that is past idleHolderAfter, and zero otherwise
+func idleFor(state string, idle sql.NullFloat64) time.Duration {
+	if state != "idle" || !idle.Valid {
+		return 0
+	}
+	d := (time.Duration(idle.Float64) * time.Second).Round(time.Second)
+	if d <= idleHolderAfter {
+		return 0
+	}
+	return d
+}
+
+// markAbandoned closes the sync_runs rows left running by syncs of
+// source that died, reporting each
+func markAbandoned(ctx context.Context, conn *sql.Conn, source string) error {
+	rows, err := conn.QueryContext(ctx, `
+        UPDATE sync_runs SET status = 'abandoned', finished_at = now()
+        WHERE source = $1 AND status = 'running'
+        RETURNING id, COALESCE(username, ''), COALESCE(host, ''), started_at
+    `, source)
+	if err != nil {
+		return fmt.Errorf("failed to check for stale sync runs: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var username, host string
+		var started time.Time
+		if err := rows.Scan(&id, &username, &host, &started); err != nil {
+			return fmt.Errorf("failed to scan sync run: %v", err)
+		}
+		log.Printf("Sync run %d of source %s by %s@%s started %s never finished, marked abandoned",
+			id, source, username, host, started.Local().Format(time.RFC3339))
+	}
+	return rows.Err()
+}
+
+// release records how the run ended, failed when runErr is set, and
+// gives the lock up
+func (l *syncLock) release(counts runCounts, runErr error) {
+	ctx := context.Background()
+	defer l.conn.Close()
+
+	status := "done"
+	var errText sql.NullString
+	if runErr != nil {
+		status = "failed"
+		errText = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+
+	if l.runID != 0 {
+		_, err := l.conn.ExecContext(ctx, `
+            UPDATE sync_runs
+            SET status = $1, finished_at = now(), written = $2, not_applied = $3, skipped = $4, deleted = $5, error = $6
+            WHERE id = $7
+        `, status, counts.Written, counts.NotApplied, counts.Skipped, counts.Deleted, errText, l.runID)
+		if err != nil {
+			log.Println("Failed to record the end of the sync run:", err)
+		}
+	}
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		log.Println("Failed to release the sync lock:", err)
+	}
+}
@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockKey(t *testing.T) {
+	key := lockKey("documents", "reports")
+	if again := lockKey("documents", "reports"); again != key {
+		t.Errorf("lockKey() = %d then %d, want it stable across runs", key, again)
+	}
+
+	// each pair is a different lock
+	pairs := [][2]string{
+		{"documents", "reports"},
+		{"documents", "letters"},
+		{"documents_v2", "reports"},
+		{"documentsr", "eports"},
+		{"documents", ""},
+	}
+	seen := make(map[int64][2]string)
+	for _, pair := range pairs {
+		key := lockKey(pair[0], pair[1])
+		if prev, ok := seen[key]; ok {
+			t.Errorf("lockKey(%q) = lockKey(%q) = %d", pair, prev, key)
+		}
+		seen[key] = pair
+	}
+}
+
+func TestDescribeRun(t *testing.T) {
+	started := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	got := describeRun(4242, &holderRun{username: "ana", host: "worker1", pid: 77, started: started})
+	for _, want := range []string{"ana@worker1", "pid 77", started.Local().Format(time.RFC3339)} {
+		if !strings.Contains(got, want) {
+			t.Errorf("describeRun() = %q, want it to name %q", got, want)
+		}
+	}
+	if strings.Contains(got, "4242") {
+		t.Errorf("describeRun() = %q, want the run named rather than the backend", got)
+	}
+
+	if got := describeRun(4242, nil); !strings.Contains(got, "backend 4242") {
+		t.Errorf("describeRun() without a run = %q, want the backend named", got)
+	}
+}
+
+func TestIdleFor(t *testing.T) {
+	seconds := func(s float64) sql.NullFloat64 { return sql.NullFloat64{Float64: s, Valid: true} }
+	limit := idleHolderAfter.Seconds()
+
+	tests := []struct {
+		name  string
+		state string
+		idle  sql.NullFloat64
+		want  time.Duration
+	}{
+		{"active", "active", seconds(limit * 2), 0},
+		{"idle in transaction", "idle in transaction", seconds(limit * 2), 0},
+		{"idle briefly", "idle", seconds(30), 0},
+		{"idle exactly the limit", "idle", seconds(limit), 0},
+		{"idle past the limit", "idle", seconds(limit + 1.4), idleHolderAfter + time.Second},
+		{"unknown idle time", "idle", sql.NullFloat64{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := idleFor(tt.state, tt.idle); got != tt.want {
+				t.Errorf("idleFor(%q, %v) = %s, want %s", tt.state, tt.idle, got, tt.want)
+			}
+		})
+	}
+}
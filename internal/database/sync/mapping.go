@@ -0,0 +1,432 @@
+package sync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EXTRA_IGNORE   = "ignore"
+	EXTRA_METADATA = "metadata"
+)
+
+// recordFields are the Record fields a source column can map to
+var recordFields = []string{"id", "file_path", "file_type", "content", "content_hash",
+	"extraction_version", "urls", "names", "tokens", "places", "metadata"}
+
+// ColumnMapping maps one source column onto a Record field. Transform
+// is a "|" separated chain of trim, lower, upper, basename and
+// null_if_empty applied before the value is stored
+type ColumnMapping struct {
+	Target    string `json:"target"`
+	Transform string `json:"transform,omitempty"`
+}
+
+// Mapping configures how source rows are read. Columns are keyed by
+// source column name. Source columns named like a Record field map to
+// it unless that field is already a target. Extra decides what happens
+// to the remaining columns: EXTRA_IGNORE or EXTRA_METADATA to pack
+// them into the metadata json
+type Mapping struct {
+	Table   string                   `json:"table"`
+	Columns map[string]ColumnMapping `json:"columns"`
+	Extra   string                   `json:"extra"`
+}
+
+// DefaultMapping reads documents with columns named after Record fields
+func DefaultMapping() Mapping {
+	return Mapping{Table: "documents", Columns: map[string]ColumnMapping{}, Extra: EXTRA_IGNORE}
+}
+
+// LoadMapping reads a mapping config file
+func LoadMapping(fileName string) (Mapping, error) {
+	mapping := DefaultMapping()
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return mapping, err
+	}
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return mapping, fmt.Errorf("failed to parse mapping %s: %v", fileName, err)
+	}
+
+	if mapping.Table == "" {
+		mapping.Table = "documents"
+	}
+	if mapping.Columns == nil {
+		mapping.Columns = map[string]ColumnMapping{}
+	}
+	if mapping.Extra != EXTRA_IGNORE && mapping.Extra != EXTRA_METADATA {
+		return mapping, fmt.Errorf("extra must be %s or %s", EXTRA_IGNORE, EXTRA_METADATA)
+	}
+
+	for column, m := range mapping.Columns {
+		if !slices.Contains(recordFields, m.Target) {
+			return mapping, fmt.Errorf("column %s maps to unknown field %q", column, m.Target)
+		}
+		if _, err := applyTransform(m.Transform, ""); err != nil {
+			return mapping, fmt.Errorf("column %s: %v", column, err)
+		}
+	}
+
+	return mapping, nil
+}
+
+// applyTransform runs a transform chain on a value. A nil result means
+// the value became NULL
+func applyTransform(chain string, value string) (*string, error) {
+	if chain == "" {
+		return &value, nil
+	}
+
+	for _, step := range strings.Split(chain, "|") {
+		switch strings.TrimSpace(step) {
+		case "trim":
+			value = strings.TrimSpace(value)
+		case "lower":
+			value = strings.ToLower(value)
+		case "upper":
+			value = strings.ToUpper(value)
+		case "basename":
+			value = path.Base(value)
+		case "null_if_empty":
+			if value == "" {
+				return nil, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown transform %q", step)
+		}
+	}
+	return &value, nil
+}
+
+// quoteIdent quotes a sqlite identifier
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sourceReader selects source columns by name and turns rows into
+// Records according to a Mapping
+type sourceReader struct {
+	db *sql.DB
+	// name and sourceID identify the source in sync_sources
+	name     string
+	sourceID int64
+	// clean sanitizes every text value read, nil only strips NULs
+	clean *sanitizer
+	// listDelimiter is passed to parseList, empty detects it
+	listDelimiter string
+	// paths fills CanonicalPath, nil leaves it empty
+	paths *pathRewriter
+
+	table   string
+	columns []string
+	targets []ColumnMapping
+	extra   string
+	// byTarget is the source column for each mapped Record field
+	byTarget map[string]string
+}
+
+func newSourceReader(db *sql.DB, mapping Mapping) (*sourceReader, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", quoteIdent(mapping.Table)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SQLite columns: %v", err)
+	}
+	defer rows.Close()
+
+	var available []string
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
+			return nil, fmt.Errorf("failed to scan column info: %v", err)
+		}
+		available = append(available, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(available) == 0 {
+		return nil, fmt.Errorf("table %s not found in SQLite", mapping.Table)
+	}
+
+	reader := &sourceReader{db: db, table: mapping.Table, extra: mapping.Extra, byTarget: make(map[string]string)}
+
+	// Explicit mappings first so they win over same-named columns
+	for column, m := range mapping.Columns {
+		if !slices.Contains(available, column) {
+			return nil, fmt.Errorf("mapped column %s not found in SQLite table %s", column, mapping.Table)
+		}
+		if prev, ok := reader.byTarget[m.Target]; ok {
+			return nil, fmt.Errorf("columns %s and %s both map to %s", prev, column, m.Target)
+		}
+		reader.byTarget[m.Target] = column
+	}
+
+	for _, column := range available {
+		m, ok := mapping.Columns[column]
+		if !ok {
+			if _, taken := reader.byTarget[column]; slices.Contains(recordFields, column) && !taken {
+				m = ColumnMapping{Target: column}
+				reader.byTarget[column] = column
+			} else if mapping.Extra == EXTRA_IGNORE {
+				continue
+			}
+		}
+		reader.columns = append(reader.columns, column)
+		reader.targets = append(reader.targets, m)
+	}
+
+	for _, required := range []string{"id", "file_path"} {
+		if _, ok := reader.byTarget[required]; !ok {
+			return nil, fmt.Errorf("no source column maps to %s", required)
+		}
+	}
+
+	return reader, nil
+}
+
+// col returns the quoted source column for a Record field, or NULL
+// when nothing maps to it
+func (s *sourceReader) col(target string) string {
+	if column, ok := s.byTarget[target]; ok {
+		return quoteIdent(column)
+	}
+	return "NULL"
+}
+
+// selectSQL builds the query for full records, ordered by id
+func (s *sourceReader) selectSQL(where string) string {
+	cols := make([]string, len(s.columns))
+	for i, c := range s.columns {
+		cols[i] = quoteIdent(c)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ", "), quoteIdent(s.table))
+	if where != "" {
+		query += " WHERE " + where
+	}
+	return query + " ORDER BY " + s.col("id")
+}
+
+// scan reads the current row into a Record
+func (s *sourceReader) scan(rows *sql.Rows) (Record, error) {
+	var record Record
+
+	values := make([]any, len(s.columns))
+	ptrs := make([]any, len(s.columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return record, fmt.Errorf("failed to scan row: %v", err)
+	}
+
+	extras := make(map[string]any)
+	touched := make(map[string]bool)
+	for i, raw := range values {
+		m := s.targets[i]
+		if m.Target == "" {
+			extras[s.columns[i]] = jsonValue(raw)
+			continue
+		}
+
+		var value *string
+		if raw != nil {
+			str := s.cleanText(m.Target, stringValue(raw), touched)
+			var err error
+			value, err = applyTransform(m.Transform, str)
+			if err != nil {
+				return record, err
+			}
+		}
+
+		if err := setField(&record, m.Target, value); err != nil {
+			return record, fmt.Errorf("column %s: %v", s.columns[i], err)
+		}
+	}
+
+	if len(extras) > 0 {
+		record.Metadata = packExtras(record.Metadata, extras)
+	}
+	if s.clean != nil {
+		s.clean.record(touched)
+	}
+	parseLists(&record, s.listDelimiter)
+	if s.paths != nil {
+		record.CanonicalPath = s.paths.canonical(record.FilePath)
+	}
+
+	return record, nil
+}
+
+// readPaths returns the local id of every source row by its path, as
+// the upsert stores it. Documents are keyed on the path, so a path two
+// rows share is an error instead of one silently overwriting the other
+func (s *sourceReader) readPaths() (map[string]int64, error) {
+	var transform string
+	for i, m := range s.targets {
+		if m.Target == "file_path" && s.columns[i] == s.byTarget["file_path"] {
+			transform = m.Transform
+		}
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf("SELECT %s, %s FROM %s ORDER BY %s",
+		s.col("id"), s.col("file_path"), quoteIdent(s.table), s.col("id")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SQLite: %v", err)
+	}
+	defer rows.Close()
+
+	paths := make(map[string]int64)
+	for rows.Next() {
+		var id int64
+		var raw any
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+
+		var path string
+		if raw != nil {
+			value, err := applyTransform(transform, s.cleanText("file_path", stringValue(raw), nil))
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				path = sanitizeString(*value)
+			}
+		}
+
+		if prev, ok := paths[path]; ok {
+			return nil, fmt.Errorf("ids %d and %d of %s share the file_path %q, paths must be unique within a source", prev, id, s.table, path)
+		}
+		paths[path] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %v", err)
+	}
+	return paths, nil
+}
+
+// cleanText sanitizes a value read for target field
+func (s *sourceReader) cleanText(field, value string, touched map[string]bool) string {
+	if s.clean == nil {
+		return sanitizeString(value)
+	}
+	return s.clean.text(field, value, touched)
+}
+
+// stringValue converts a value returned by the sqlite driver to text
+func stringValue(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// jsonValue keeps numbers as numbers when packing extras into metadata
+func jsonValue(v any) any {
+	switch val := v.(type) {
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return val
+	}
+}
+
+func setField(record *Record, target string, value *string) error {
+	switch target {
+	case "id":
+		if value == nil {
+			return fmt.Errorf("id is NULL")
+		}
+		id, err := strconv.ParseInt(*value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("id %q is not an integer", *value)
+		}
+		record.ID = id
+	case "extraction_version":
+		if value == nil {
+			record.ExtractionVersion = nil
+			return nil
+		}
+		version, err := strconv.ParseInt(*value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("extraction_version %q is not an integer", *value)
+		}
+		record.ExtractionVersion = &version
+	case "file_path":
+		if value != nil {
+			record.FilePath = *value
+		}
+	case "content":
+		if value != nil {
+			record.Content = *value
+		}
+	case "file_type":
+		record.FileType = value
+	case "content_hash":
+		record.ContentHash = value
+	case "urls":
+		record.Urls = value
+	case "names":
+		record.Names = value
+	case "tokens":
+		record.Tokens = value
+	case "places":
+		record.Places = value
+	case "metadata":
+		record.Metadata = value
+	}
+	return nil
+}
+
+// packExtras merges unmapped columns into the metadata json object.
+// Existing keys win, metadata that is not an object is kept under
+// the "metadata" key
+func packExtras(metadata *string, extras map[string]any) *string {
+	obj := make(map[string]any)
+	if metadata != nil && *metadata != "" {
+		if err := json.Unmarshal([]byte(*metadata), &obj); err != nil {
+			obj = map[string]any{"metadata": *metadata}
+		}
+	}
+	if obj == nil {
+		obj = make(map[string]any)
+	}
+
+	for k, v := range extras {
+		if _, exists := obj[k]; !exists {
+			obj[k] = v
+		}
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return metadata
+	}
+	packed := string(data)
+	return &packed
+}
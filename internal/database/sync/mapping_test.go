@@ -0,0 +1,123 @@
+package sync
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyTransform(t *testing.T) {
+	tests := []struct {
+		name    string
+		chain   string
+		in      string
+		want    *string
+		wantErr bool
+	}{
+		{name: "no chain", chain: "", in: " A ", want: strPtr(" A ")},
+		{name: "trim", chain: "trim", in: "  a b  ", want: strPtr("a b")},
+		{name: "lower", chain: "lower", in: "PDF", want: strPtr("pdf")},
+		{name: "upper", chain: "upper", in: "pdf", want: strPtr("PDF")},
+		{name: "basename", chain: "basename", in: "/data/a/b.pdf", want: strPtr("b.pdf")},
+		{name: "chain in order", chain: "trim|basename|upper", in: " /x/y.txt ", want: strPtr("Y.TXT")},
+		{name: "spaces around steps", chain: " trim | lower ", in: " AB ", want: strPtr("ab")},
+		{name: "null if empty", chain: "null_if_empty", in: "", want: nil},
+		{name: "null after trim", chain: "trim|null_if_empty", in: "   ", want: nil},
+		{name: "null keeps values", chain: "null_if_empty", in: "a", want: strPtr("a")},
+		{name: "unknown step", chain: "trim|reverse", in: "a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyTransform(tt.chain, tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("applyTransform(%q) succeeded, want an error", tt.chain)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalNullable(got, tt.want) {
+				t.Errorf("applyTransform(%q, %q) = %v, want %v", tt.chain, tt.in, deref(got), deref(tt.want))
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func deref(s *string) any {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+// openTestSource creates a sqlite source with an id and a path column
+// and returns a reader for it under mapping
+func openTestSource(t *testing.T, mapping Mapping, rows map[int64]string) *sourceReader {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "src.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("CREATE TABLE documents (id INTEGER, path TEXT, content TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for id, path := range rows {
+		if _, err := db.Exec("INSERT INTO documents VALUES (?, ?, 'x')", id, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src, err := newSourceReader(db, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func TestReadPaths(t *testing.T) {
+	mapping := func(transform string) Mapping {
+		m := DefaultMapping()
+		m.Columns["path"] = ColumnMapping{Target: "file_path", Transform: transform}
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		mapping Mapping
+		rows    map[int64]string
+		want    map[string]int64
+		wantErr bool
+	}{
+		{"unique", mapping(""), map[int64]string{1: "a", 2: "b"}, map[string]int64{"a": 1, "b": 2}, false},
+		{"transform applied", mapping("trim|lower"), map[int64]string{1: " A ", 2: "b"}, map[string]int64{"a": 1, "b": 2}, false},
+		{"nul removed", mapping(""), map[int64]string{1: "a\x00b"}, map[string]int64{"ab": 1}, false},
+		{"repeated path", mapping(""), map[int64]string{1: "a", 2: "a"}, nil, true},
+		{"repeated after transform", mapping("lower"), map[int64]string{1: "A", 2: "a"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := openTestSource(t, tt.mapping, tt.rows).readPaths()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("readPaths() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
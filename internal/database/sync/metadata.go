@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	gosync "sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// invalidJSONPath groups metadata that is not JSON at all
+const invalidJSONPath = "(not json)"
+
+// metadataSchema validates record metadata against a JSON Schema and
+// groups the failures per source by the schema path that rejected them
+type metadataSchema struct {
+	schema *jsonschema.Schema
+
+	mu       gosync.Mutex
+	failures map[string]map[string][]int64
+}
+
+func loadMetadataSchema(path string) (*metadataSchema, error) {
+	schema, err := jsonschema.Compile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata schema: %v", err)
+	}
+	return &metadataSchema{schema: schema, failures: make(map[string]map[string][]int64)}, nil
+}
+
+// validate checks the metadata of a record, NULL metadata is not
+// validated. The error lists every failing schema path
+func (m *metadataSchema) validate(source string, record *Record) error {
+	if record.Metadata == nil {
+		return nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(*record.Metadata))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		m.fail(source, record.ID, invalidJSONPath)
+		return fmt.Errorf("metadata is not valid json: %v", err)
+	}
+
+	err := m.schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return fmt.Errorf("metadata validation failed: %v", err)
+	}
+
+	var messages []string
+	for _, leaf := range leafErrors(verr) {
+		m.fail(source, record.ID, leaf.KeywordLocation)
+		messages = append(messages, fmt.Sprintf("%s: %s", leaf.KeywordLocation, leaf.Message))
+	}
+	return fmt.Errorf("metadata does not match schema: %s", strings.Join(messages, "; "))
+}
+
+// leafErrors returns the innermost causes, which name the keyword that
+// actually failed
+func leafErrors(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		leaves = append(leaves, leafErrors(cause)...)
+	}
+	return leaves
+}
+
+func (m *metadataSchema) fail(source string, id int64, path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failures[source] == nil {
+		m.failures[source] = make(map[string][]int64)
+	}
+	ids := m.failures[source][path]
+	if len(ids) == 0 || ids[len(ids)-1] != id {
+		m.failures[source][path] = append(ids, id)
+	}
+}
+
+// report prints the failures per source and schema path
+func (m *metadataSchema) report() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sources := make([]string, 0, len(m.failures))
+	for source := range m.failures {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		fmt.Printf("Metadata validation failures of source %s by schema path:\n", source)
+		paths := make([]string, 0, len(m.failures[source]))
+		for path := range m.failures[source] {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			ids := m.failures[source][path]
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			fmt.Printf("  %-40s %d records: %s\n", path, len(ids), formatIDRanges(ids))
+		}
+	}
+}
+
+// metadataJSON returns metadata compacted for the jsonb column, or nil
+// when it is not JSON or holds a NUL escape postgres refuses
+func metadataJSON(metadata *string) *string {
+	if metadata == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(sanitizeString(*metadata))); err != nil {
+		return nil
+	}
+	if bytes.Contains(buf.Bytes(), []byte(`\u0000`)) {
+		return nil
+	}
+	compact := buf.String()
+	return &compact
+}
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMetadataSchema = `{
+  "type": "object",
+  "required": ["title"],
+  "properties": {
+    "title": {"type": "string"},
+    "year": {"type": "integer", "minimum": 1800}
+  }
+}`
+
+func TestMetadataSchemaValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(testMetadataSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := loadMetadataSchema(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name     string
+		metadata *string
+		// want lists a substring of the error, empty means valid
+		want []string
+	}{
+		{"null metadata", nil, nil},
+		{"valid", str(`{"title": "a", "year": 1999}`), nil},
+		{"big integer", str(`{"title": "a", "year": 12345678901234567890}`), nil},
+		{"not json", str(`{"title": `), []string{"not valid json"}},
+		{"missing required", str(`{"year": 1999}`), []string{"/required"}},
+		{"wrong type", str(`{"title": 3}`), []string{"/properties/title/type"}},
+		{"every failure listed", str(`{"year": 1700}`), []string{"/required", "/properties/year/minimum"}},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.validate("src", &Record{ID: int64(i), Metadata: tt.metadata})
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validate() = nil, want an error naming %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validate() = %v, want it to name %q", err, want)
+				}
+			}
+		})
+	}
+
+	want := map[string][]int64{
+		invalidJSONPath:            {3},
+		"/required":                {4, 6},
+		"/properties/title/type":   {5},
+		"/properties/year/minimum": {6},
+	}
+	if got := schema.failures["src"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("failures = %v, want %v", got, want)
+	}
+}
+
+func TestLoadMetadataSchemaErrors(t *testing.T) {
+	bad := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(bad, []byte(`{"type": 3}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{bad, filepath.Join(t.TempDir(), "missing.json")} {
+		if _, err := loadMetadataSchema(path); err == nil {
+			t.Errorf("loadMetadataSchema(%s) succeeded, want an error", path)
+		}
+	}
+}
+
+func TestMetadataJSON(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name     string
+		metadata *string
+		want     *string
+	}{
+		{"null", nil, nil},
+		{"compacted", str("{\"a\": [1, 2],\n \"b\": \"x\"}"), str(`{"a":[1,2],"b":"x"}`)},
+		{"not json", str("title: a"), nil},
+		{"nul escape", str(`{"a": "x\u0000y"}`), nil},
+		{"raw nul sanitized", str("{\"a\": \"x\x00y\"}"), str(`{"a":"xy"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metadataJSON(tt.metadata); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("metadataJSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
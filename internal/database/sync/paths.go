@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// PrefixRule replaces a leading From of a path with To. From matches
+// whole path segments, so /data does not match /data2
+type PrefixRule struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RegexRule replaces every match of Pattern with Replace, which may
+// refer to groups as $1 or ${name}
+type RegexRule struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+// PathRules configure how source paths become canonical paths. The
+// first matching prefix rule applies, then every regex rule in order
+type PathRules struct {
+	Prefix []PrefixRule `json:"prefix"`
+	Regex  []RegexRule  `json:"regex"`
+}
+
+// LoadPathRules reads a path rules config file
+func LoadPathRules(fileName string) (PathRules, error) {
+	var rules PathRules
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return rules, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("failed to parse path rules %s: %v", fileName, err)
+	}
+	return rules, nil
+}
+
+// ParsePrefixRules parses from=to pairs given on the command line
+func ParsePrefixRules(pairs []string) ([]PrefixRule, error) {
+	rules := make([]PrefixRule, 0, len(pairs))
+	for _, pair := range pairs {
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || from == "" {
+			return nil, fmt.Errorf("path prefix %q is not from=to", pair)
+		}
+		rules = append(rules, PrefixRule{From: from, To: to})
+	}
+	return rules, nil
+}
+
+// pathRewriter turns the path a worker saw into the canonical path,
+// relative and slash separated like models.Entry.RelativePath when the
+// rules strip the worker's mount point
+type pathRewriter struct {
+	prefix  []PrefixRule
+	regex   []*regexp.Regexp
+	replace []string
+}
+
+func newPathRewriter(rules PathRules) (*pathRewriter, error) {
+	r := &pathRewriter{}
+	for _, rule := range rules.Prefix {
+		// rules are compared with the path after its backslashes
+		// become slashes, a trailing slash is implied
+		from := trimSlash(slashes(rule.From))
+		if from == "" {
+			return nil, fmt.Errorf("prefix rule to %q has no from", rule.To)
+		}
+		r.prefix = append(r.prefix, PrefixRule{From: from, To: trimSlash(slashes(rule.To))})
+	}
+	for _, rule := range rules.Regex {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path regex %q: %v", rule.Pattern, err)
+		}
+		r.regex = append(r.regex, re)
+		r.replace = append(r.replace, rule.Replace)
+	}
+	return r, nil
+}
+
+// canonical applies the rules to a path. Backslashes become slashes
+// first so one rule covers paths from windows workers, and the result
+// is cleaned
+func (r *pathRewriter) canonical(p string) string {
+	p = slashes(p)
+
+	for _, rule := range r.prefix {
+		rest, ok := strings.CutPrefix(p, rule.From)
+		// only "/" itself ends in a slash after trimSlash
+		if !ok || (rest != "" && rest[0] != '/' && rule.From != "/") {
+			continue
+		}
+		rest = strings.TrimPrefix(rest, "/")
+		switch {
+		case rule.To == "":
+			p = rest
+		case rest == "":
+			p = rule.To
+		default:
+			p = rule.To + "/" + rest
+		}
+		break
+	}
+	for i, re := range r.regex {
+		p = re.ReplaceAllString(p, r.replace[i])
+	}
+
+	if p == "" {
+		return p
+	}
+	return path.Clean(p)
+}
+
+// writeRules writes the rules in the order they apply, so a sync
+// watermark changes with them
+func (r *pathRewriter) writeRules(w io.Writer) {
+	for _, rule := range r.prefix {
+		fmt.Fprintf(w, "prefix|%q|%q\n", rule.From, rule.To)
+	}
+	for i, re := range r.regex {
+		fmt.Fprintf(w, "regex|%q|%q\n", re.String(), r.replace[i])
+	}
+}
+
+func slashes(p string) string {
+	return strings.ReplaceAll(p, `\`, "/")
+}
+
+// trimSlash drops a trailing slash other than the root's
+func trimSlash(p string) string {
+	if len(p) > 1 {
+		return strings.TrimSuffix(p, "/")
+	}
+	return p
+}
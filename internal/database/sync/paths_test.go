@@ -0,0 +1,107 @@
+package sync
+
+import "testing"
+
+func TestPathRewriterCanonical(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules PathRules
+		in    string
+		want  string
+	}{
+		{"no rules cleans", PathRules{}, "/data/./a//b.txt", "/data/a/b.txt"},
+		{"backslashes", PathRules{}, `C:\data\a.txt`, "C:/data/a.txt"},
+		{"empty", PathRules{}, "", ""},
+		{"prefix stripped", PathRules{Prefix: []PrefixRule{{From: "/mnt/worker3/data/", To: ""}}},
+			"/mnt/worker3/data/a/b.pdf", "a/b.pdf"},
+		{"prefix without trailing slash", PathRules{Prefix: []PrefixRule{{From: "/mnt/worker3/data", To: "."}}},
+			"/mnt/worker3/data/a/b.pdf", "a/b.pdf"},
+		{"prefix stops at segment boundary", PathRules{Prefix: []PrefixRule{{From: "/mnt/worker3/data", To: "."}}},
+			"/mnt/worker3/data2/b.pdf", "/mnt/worker3/data2/b.pdf"},
+		{"prefix matches whole path", PathRules{Prefix: []PrefixRule{{From: "/mnt/data", To: "root"}}},
+			"/mnt/data", "root"},
+		{"prefix to another root", PathRules{Prefix: []PrefixRule{{From: "/mnt/worker3/data", To: "/srv/data/"}}},
+			"/mnt/worker3/data/a.pdf", "/srv/data/a.pdf"},
+		{"windows rule", PathRules{Prefix: []PrefixRule{{From: `C:\data\`, To: ""}}},
+			`C:\data\c\d.txt`, "c/d.txt"},
+		{"root prefix", PathRules{Prefix: []PrefixRule{{From: "/", To: "abs"}}},
+			"/a/b.txt", "abs/a/b.txt"},
+		{"first prefix wins", PathRules{Prefix: []PrefixRule{{From: "/mnt", To: "x"}, {From: "/mnt/data", To: "y"}}},
+			"/mnt/data/a", "x/data/a"},
+		{"regex", PathRules{Regex: []RegexRule{{Pattern: `^/mnt/worker\d+/data/`, Replace: ""}}},
+			"/mnt/worker12/data/a.txt", "a.txt"},
+		{"regex groups", PathRules{Regex: []RegexRule{{Pattern: `^/(\w+)/(\w+)`, Replace: "$2/$1"}}},
+			"/a/b/c", "b/a/c"},
+		{"prefix then regex", PathRules{
+			Prefix: []PrefixRule{{From: "/mnt/data", To: ""}},
+			Regex:  []RegexRule{{Pattern: `\.PDF$`, Replace: ".pdf"}}},
+			"/mnt/data/x.PDF", "x.pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newPathRewriter(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.canonical(tt.in); got != tt.want {
+				t.Errorf("canonical(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPathRewriterErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules PathRules
+	}{
+		{"empty from", PathRules{Prefix: []PrefixRule{{From: "", To: "x"}}}},
+		{"bad regex", PathRules{Regex: []RegexRule{{Pattern: "(", Replace: ""}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newPathRewriter(tt.rules); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParsePrefixRules(t *testing.T) {
+	tests := []struct {
+		in      []string
+		want    []PrefixRule
+		wantErr bool
+	}{
+		{in: nil, want: []PrefixRule{}},
+		{in: []string{"/mnt/data=", "/a=/b"}, want: []PrefixRule{{From: "/mnt/data", To: ""}, {From: "/a", To: "/b"}}},
+		{in: []string{"/a=b=c"}, want: []PrefixRule{{From: "/a", To: "b=c"}}},
+		{in: []string{"nodelimiter"}, wantErr: true},
+		{in: []string{"=b"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePrefixRules(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParsePrefixRules(%q) succeeded, want an error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePrefixRules(%q): %v", tt.in, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParsePrefixRules(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParsePrefixRules(%q)[%d] = %v, want %v", tt.in, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package sync
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// Plan is what a sync would do, computed by a dry run without writing
+type Plan struct {
+	Source  string `json:"source"`
+	Inserts int    `json:"inserts"`
+	Updates int    `json:"updates"`
+	Deletes int    `json:"deletes"`
+	Skips   int    `json:"skips"`
+	// Kept counts changed rows the conflict strategy would not apply,
+	// under CONFLICT_FAIL every row already in the destination
+	Kept     int    `json:"kept"`
+	Conflict string `json:"conflict"`
+	// ChangedColumns counts updated rows per changed column
+	ChangedColumns map[string]int `json:"changed_columns"`
+	DeleteMode     string         `json:"delete_mode"`
+	// DeleteAbort is set when the deletion threshold would stop the sync
+	DeleteAbort string `json:"delete_abort,omitempty"`
+
+	SampleInserts []int64 `json:"sample_inserts,omitempty"`
+	SampleUpdates []int64 `json:"sample_updates,omitempty"`
+	SampleDeletes []int64 `json:"sample_deletes,omitempty"`
+	SampleKept    []int64 `json:"sample_kept,omitempty"`
+
+	sampleSize int
+}
+
+func (p *Plan) sample(ids *[]int64, id int64) {
+	if len(*ids) < p.sampleSize {
+		*ids = append(*ids, id)
+	}
+}
+
+// remoteRow is the remote copy of a document, content is compared on
+// its md5 so it does not have to cross the network
+type remoteRow struct {
+	values     map[string]*string
+	lists      map[string][]string
+	contentMD5 string
+	deleted    bool
+}
+
+// fetchRemote loads the remote rows of a source for the paths of a
+// batch, matching them the way the upsert does
+func fetchRemote(pgDB *sql.DB, sourceID int64, paths []string) (map[string]remoteRow, error) {
+	rows, err := pgDB.Query(`
+        SELECT local_id::text, file_path, file_type, md5(content), content_hash, extraction_version::text,
+               urls, names, tokens, places, metadata, canonical_path, deleted_at IS NOT NULL,
+               url_list, name_list, place_list, token_list, metadata_json::text
+        FROM documents WHERE source_id = $1 AND file_path = ANY($2)
+    `, sourceID, pq.Array(paths))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query PostgreSQL: %v", err)
+	}
+	defer rows.Close()
+
+	remote := make(map[string]remoteRow, len(paths))
+	for rows.Next() {
+		var localID, filePath, fileType, contentMD5, hash, version, urls, names, tokens, places, metadata, canonical, metaJSON sql.NullString
+		var deleted bool
+		var urlList, nameList, placeList, tokenList pq.StringArray
+		err := rows.Scan(&localID, &filePath, &fileType, &contentMD5, &hash, &version,
+			&urls, &names, &tokens, &places, &metadata, &canonical, &deleted,
+			&urlList, &nameList, &placeList, &tokenList, &metaJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+
+		remote[filePath.String] = remoteRow{
+			values: map[string]*string{
+				"local_id":           nullToPtr(localID),
+				"file_path":          nullToPtr(filePath),
+				"file_type":          nullToPtr(fileType),
+				"content_hash":       nullToPtr(hash),
+				"extraction_version": nullToPtr(version),
+				"urls":               nullToPtr(urls),
+				"names":              nullToPtr(names),
+				"tokens":             nullToPtr(tokens),
+				"places":             nullToPtr(places),
+				"metadata":           nullToPtr(metadata),
+				"canonical_path":     nullToPtr(canonical),
+				"metadata_json":      nullToPtr(metaJSON),
+			},
+			lists: map[string][]string{
+				"url_list":   urlList,
+				"name_list":  nameList,
+				"place_list": placeList,
+				"token_list": tokenList,
+			},
+			contentMD5: contentMD5.String,
+			deleted:    deleted,
+		}
+	}
+
+	return remote, rows.Err()
+}
+
+func nullToPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// changedColumns lists the columns where the sanitized record differs
+// from the remote row
+func changedColumns(record *Record, remote remoteRow) []string {
+	var version *string
+	if record.ExtractionVersion != nil {
+		v := fmt.Sprintf("%d", *record.ExtractionVersion)
+		version = &v
+	}
+	filePath := sanitizeString(record.FilePath)
+	localID := fmt.Sprintf("%d", record.ID)
+
+	local := map[string]*string{
+		"local_id":           &localID,
+		"file_path":          &filePath,
+		"file_type":          sanitizeNullString(record.FileType),
+		"content_hash":       sanitizeNullString(record.ContentHash),
+		"extraction_version": version,
+		"urls":               sanitizeNullString(record.Urls),
+		"names":              sanitizeNullString(record.Names),
+		"tokens":             sanitizeNullString(record.Tokens),
+		"places":             sanitizeNullString(record.Places),
+		"metadata":           sanitizeNullString(record.Metadata),
+		"canonical_path":     canonicalPath(record),
+		"metadata_json":      metadataJSON(record.Metadata),
+	}
+	lists := map[string][]string{
+		"url_list":   record.UrlList,
+		"name_list":  record.NameList,
+		"place_list": record.PlaceList,
+		"token_list": record.TokenList,
+	}
+
+	var changed []string
+	for _, col := range documentColumns {
+		same := true
+		switch col {
+		case "source_id":
+		case "content":
+			sum := md5.Sum([]byte(sanitizeString(record.Content)))
+			same = hex.EncodeToString(sum[:]) == remote.contentMD5
+		case "url_list", "name_list", "place_list", "token_list":
+			same = equalLists(lists[col], remote.lists[col])
+		case "metadata_json":
+			same = equalJSON(local[col], remote.values[col])
+		default:
+			same = equalNullable(local[col], remote.values[col])
+		}
+		if !same {
+			changed = append(changed, col)
+		}
+	}
+	if remote.deleted {
+		changed = append(changed, "deleted_at")
+	}
+	return changed
+}
+
+func equalNullable(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// equalLists compares list columns, a NULL list differs from an empty
+// one
+func equalLists(a, b []string) bool {
+	return (a == nil) == (b == nil) && slices.Equal(a, b)
+}
+
+// equalJSON compares metadata_json by value, jsonb does not keep the
+// spacing or key order it was written with
+func equalJSON(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var x, y any
+	if json.Unmarshal([]byte(*a), &x) != nil || json.Unmarshal([]byte(*b), &y) != nil {
+		return *a == *b
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// conflictKeeps reports whether strategy would keep the remote copy
+// of a changed row instead of applying the record
+func conflictKeeps(strategy string, record *Record, remote remoteRow) bool {
+	switch strategy {
+	case CONFLICT_SKIP_EXISTING, CONFLICT_FAIL:
+		return true
+	case CONFLICT_NEWER_WINS:
+		var local, existing int64
+		if record.ExtractionVersion != nil {
+			local = *record.ExtractionVersion
+		}
+		if v := remote.values["extraction_version"]; v != nil {
+			existing, _ = strconv.ParseInt(*v, 10, 64)
+		}
+		return existing > local
+	}
+	return false
+}
+
+// buildPlan walks the rows a sync would send and classifies each one
+// against the remote copy
+func buildPlan(src *sourceReader, pgDB *sql.DB, state *syncState, bounds idRange, config Config, deleted []int64, deleteAbort error) (*Plan, error) {
+	plan := &Plan{
+		Source:         src.name,
+		ChangedColumns: make(map[string]int),
+		DeleteMode:     config.DeleteMode,
+		Conflict:       config.Conflict,
+		sampleSize:     config.PlanSample,
+	}
+
+	visited, err := forEachBatch(src, pgDB, state, bounds, config.BatchSize, func(batch []Record) error {
+		paths := make([]string, len(batch))
+		for i := range batch {
+			paths[i] = sanitizeString(batch[i].FilePath)
+		}
+
+		remote, err := fetchRemote(pgDB, src.sourceID, paths)
+		if err != nil {
+			return err
+		}
+
+		for i := range batch {
+			row, ok := remote[paths[i]]
+			if !ok {
+				plan.Inserts++
+				plan.sample(&plan.SampleInserts, batch[i].ID)
+				continue
+			}
+
+			// the real write aborts on any existing row, changed or not
+			if config.Conflict == CONFLICT_FAIL {
+				plan.Kept++
+				plan.sample(&plan.SampleKept, batch[i].ID)
+				continue
+			}
+			changed := changedColumns(&batch[i], row)
+			if len(changed) == 0 {
+				continue
+			}
+			if conflictKeeps(config.Conflict, &batch[i], row) {
+				plan.Kept++
+				plan.sample(&plan.SampleKept, batch[i].ID)
+				continue
+			}
+			plan.Updates++
+			plan.sample(&plan.SampleUpdates, batch[i].ID)
+			for _, col := range changed {
+				plan.ChangedColumns[col]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// unchanged rows and those change detection passed over
+	plan.Skips = visited - plan.Inserts - plan.Updates - plan.Kept
+
+	if deleteAbort != nil {
+		plan.DeleteAbort = deleteAbort.Error()
+	} else {
+		plan.Deletes = len(deleted)
+	}
+	for _, id := range deleted {
+		plan.sample(&plan.SampleDeletes, id)
+	}
+
+	return plan, nil
+}
+
+// writePlans prints the plans of every source of a run as one JSON
+// array
+func writePlans(w io.Writer, plans []*Plan) error {
+	if plans == nil {
+		plans = []*Plan{}
+	}
+	data, err := json.MarshalIndent(plans, "", "	")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// Write prints the plan as text
+func (p *Plan) Write(w io.Writer) error {
+	fmt.Fprintf(w, "Sync plan for %s (dry run, nothing written)\n", p.Source)
+	fmt.Fprintf(w, "  insert: %d\n", p.Inserts)
+	fmt.Fprintf(w, "  update: %d\n", p.Updates)
+
+	cols := make([]string, 0, len(p.ChangedColumns))
+	for col := range p.ChangedColumns {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	for _, col := range cols {
+		fmt.Fprintf(w, "    %-20s %d\n", col, p.ChangedColumns[col])
+	}
+
+	fmt.Fprintf(w, "  delete: %d (%s)\n", p.Deletes, p.DeleteMode)
+	fmt.Fprintf(w, "  skip:   %d\n", p.Skips)
+	fmt.Fprintf(w, "  kept:   %d (%s)\n", p.Kept, p.Conflict)
+	if p.Conflict == CONFLICT_FAIL && p.Kept > 0 {
+		fmt.Fprintf(w, "  sync would abort: %d rows already exist\n", p.Kept)
+	}
+	if p.DeleteAbort != "" {
+		fmt.Fprintf(w, "  sync would abort: %s\n", p.DeleteAbort)
+	}
+
+	if len(p.SampleInserts) > 0 {
+		fmt.Fprintf(w, "  sample inserts: %s\n", formatIDRanges(p.SampleInserts))
+	}
+	if len(p.SampleUpdates) > 0 {
+		fmt.Fprintf(w, "  sample updates: %s\n", formatIDRanges(p.SampleUpdates))
+	}
+	if len(p.SampleDeletes) > 0 {
+		fmt.Fprintf(w, "  sample deletes: %s\n", formatIDRanges(p.SampleDeletes))
+	}
+	if len(p.SampleKept) > 0 {
+		fmt.Fprintf(w, "  sample kept:    %s\n", formatIDRanges(p.SampleKept))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestChangedColumns(t *testing.T) {
+	str := func(s string) *string { return &s }
+	sum := md5.Sum([]byte("body"))
+
+	// remote is the stored copy of the record below
+	remote := func() remoteRow {
+		return remoteRow{
+			values: map[string]*string{
+				"local_id":       str("7"),
+				"file_path":      str("a.txt"),
+				"urls":           str("https://a.org"),
+				"metadata":       str(`{"a": 1, "b": [2]}`),
+				"metadata_json":  str(`{"a": 1, "b": [2]}`),
+				"canonical_path": str("docs/a.txt"),
+			},
+			lists: map[string][]string{
+				"url_list":  {"https://a.org"},
+				"name_list": {},
+			},
+			contentMD5: hex.EncodeToString(sum[:]),
+		}
+	}
+	record := func() Record {
+		return Record{
+			ID:            7,
+			FilePath:      "a.txt",
+			Content:       "body",
+			Urls:          str("https://a.org"),
+			Metadata:      str(`{"a": 1, "b": [2]}`),
+			UrlList:       []string{"https://a.org"},
+			NameList:      []string{},
+			CanonicalPath: "docs/a.txt",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(r *Record, remote *remoteRow)
+		want   []string
+	}{
+		{"unchanged", func(r *Record, remote *remoteRow) {}, nil},
+		{"jsonb spacing and key order", func(r *Record, remote *remoteRow) {
+			remote.values["metadata_json"] = str(`{"b": [2], "a": 1}`)
+		}, nil},
+		{"content", func(r *Record, remote *remoteRow) { r.Content = "other" }, []string{"content"}},
+		{"url list", func(r *Record, remote *remoteRow) {
+			r.UrlList = append(r.UrlList, "https://b.org")
+		}, []string{"url_list"}},
+		{"list order", func(r *Record, remote *remoteRow) {
+			remote.lists["url_list"] = []string{"https://b.org", "https://a.org"}
+			r.UrlList = []string{"https://a.org", "https://b.org"}
+		}, []string{"url_list"}},
+		{"null list against empty", func(r *Record, remote *remoteRow) { r.NameList = nil }, []string{"name_list"}},
+		{"list never written", func(r *Record, remote *remoteRow) { r.TokenList = []string{"alpha"} }, []string{"token_list"}},
+		{"metadata value", func(r *Record, remote *remoteRow) {
+			remote.values["metadata_json"] = str(`{"a": 2, "b": [2]}`)
+		}, []string{"metadata_json"}},
+		{"canonical path", func(r *Record, remote *remoteRow) { r.CanonicalPath = "docs/b.txt" }, []string{"canonical_path"}},
+		{"canonical path cleared", func(r *Record, remote *remoteRow) { r.CanonicalPath = "" }, []string{"canonical_path"}},
+		{"tombstone", func(r *Record, remote *remoteRow) { remote.deleted = true }, []string{"deleted_at"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, row := record(), remote()
+			tt.change(&r, &row)
+			if got := changedColumns(&r, row); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changedColumns() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
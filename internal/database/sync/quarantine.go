@@ -0,0 +1,550 @@
+package sync
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	ERROR_ABORT      = "abort"
+	ERROR_SKIP       = "skip"
+	ERROR_QUARANTINE = "quarantine"
+)
+
+// Status of a quarantine entry. Skipped records are stored as well,
+// since the high-water mark moves past them and only a retry resends
+// them
+const (
+	STATUS_QUARANTINED = "quarantined"
+	STATUS_SKIPPED     = "skipped"
+)
+
+// quarantineEntry is a record that could not be written and why
+type quarantineEntry struct {
+	Source   string    `json:"source"`
+	LocalID  int64     `json:"local_id"`
+	FilePath string    `json:"file_path"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+	Status   string    `json:"status,omitempty"`
+}
+
+// quarantineStore keeps quarantined records until they are retried
+type quarantineStore interface {
+	add(sourceID int64, entries []quarantineEntry) error
+	load(sourceID int64, source string) ([]int64, error)
+	clear(sourceID int64, source string, ids []int64) error
+}
+
+// quarantine applies the --on-error policy to failed batches. For the
+// final summary it collects per source the ids it set aside and the
+// ids the conflict strategy did not apply
+type quarantine struct {
+	policy   string
+	conflict string
+	store    quarantineStore
+	// schema, when set, rejects records whose metadata does not match
+	schema *metadataSchema
+
+	mu        gosync.Mutex
+	skipped   map[string][]int64
+	unapplied map[string][]int64
+}
+
+// newQuarantine picks where quarantined records go. An explicit file
+// wins, otherwise postgres destinations use the sync_quarantine table
+// and file destinations a .quarantine.jsonl next to the output
+func newQuarantine(policy, conflict, file string, dest Destination, destPath string) (*quarantine, error) {
+	switch policy {
+	case "", ERROR_ABORT, ERROR_SKIP, ERROR_QUARANTINE:
+	default:
+		return nil, fmt.Errorf("unknown error policy %q, expected %s, %s or %s", policy, ERROR_ABORT, ERROR_SKIP, ERROR_QUARANTINE)
+	}
+
+	q := &quarantine{policy: policy, conflict: conflict, skipped: make(map[string][]int64), unapplied: make(map[string][]int64)}
+	switch {
+	case file != "":
+		q.store = &fileQuarantine{path: file}
+	case isIncremental(dest):
+		q.store = tableQuarantine{db: dest.(incrementalDestination).remote()}
+	default:
+		q.store = &fileQuarantine{path: destPath + ".quarantine.jsonl"}
+	}
+	return q, nil
+}
+
+func isIncremental(dest Destination) bool {
+	_, ok := dest.(incrementalDestination)
+	return ok
+}
+
+// write writes a batch to dest. Under the skip and quarantine policies
+// a batch failing on its data is retried one record at a time, so the
+// good records still land and the failing ones are set aside. Any
+// other failure aborts, it would fail every record alike, as does a
+// row already existing under CONFLICT_FAIL. It returns the number of
+// records written
+func (q *quarantine) write(dest Destination, src *sourceReader, batch []Record, key string) (int, error) {
+	batch, err := q.validate(src, batch)
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+
+	unapplied, err := dest.WriteBatch(src.sourceID, batch, key)
+	if err == nil {
+		q.notApplied(src, unapplied)
+		return len(batch), nil
+	}
+	if q.policy == "" || q.policy == ERROR_ABORT || !isRecordError(err, q.conflict) {
+		return 0, err
+	}
+
+	written := 0
+	var failed []quarantineEntry
+	for i := range batch {
+		unapplied, err := dest.WriteBatch(src.sourceID, batch[i:i+1], key)
+		if err != nil && !isRecordError(err, q.conflict) {
+			// what was written stays written, report what was set aside
+			if asideErr := q.setAside(src, failed); asideErr != nil {
+				log.Println(asideErr)
+			}
+			return written, err
+		}
+		if err != nil {
+			failed = append(failed, quarantineEntry{
+				Source:   src.name,
+				LocalID:  batch[i].ID,
+				FilePath: batch[i].FilePath,
+				Error:    err.Error(),
+				FailedAt: time.Now().UTC(),
+			})
+			continue
+		}
+		q.notApplied(src, unapplied)
+		written++
+	}
+
+	if err := q.setAside(src, failed); err != nil {
+		return written, err
+	}
+	return written, nil
+}
+
+// isRecordError reports whether a write failed on the data of its
+// records, a postgres data exception or integrity violation (SQLSTATE
+// classes 22 and 23) or the sqlite equivalents, rather than on the
+// connection or the schema. Under CONFLICT_FAIL a row that already
+// exists was asked to stop the sync, so it is no record error
+func isRecordError(err error, conflict string) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if conflict == CONFLICT_FAIL && pqErr.Code == "23505" {
+			return false
+		}
+		class := pqErr.Code.Class()
+		return class == "22" || class == "23"
+	}
+
+	var liteErr sqlite3.Error
+	if errors.As(err, &liteErr) {
+		if conflict == CONFLICT_FAIL && liteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return false
+		}
+		switch liteErr.Code {
+		case sqlite3.ErrConstraint, sqlite3.ErrMismatch, sqlite3.ErrTooBig:
+			return true
+		}
+	}
+	return false
+}
+
+// validate drops the records whose metadata fails the schema. Under
+// the abort policy the first failure stops the sync, otherwise the
+// failures are set aside like records that failed to write
+func (q *quarantine) validate(src *sourceReader, batch []Record) ([]Record, error) {
+	if q.schema == nil {
+		return batch, nil
+	}
+
+	valid := batch[:0:0]
+	var failed []quarantineEntry
+	for i := range batch {
+		err := q.schema.validate(src.name, &batch[i])
+		if err == nil {
+			valid = append(valid, batch[i])
+			continue
+		}
+		if q.policy == "" || q.policy == ERROR_ABORT {
+			return nil, fmt.Errorf("record %d: %v", batch[i].ID, err)
+		}
+		failed = append(failed, quarantineEntry{
+			Source:   src.name,
+			LocalID:  batch[i].ID,
+			FilePath: batch[i].FilePath,
+			Error:    err.Error(),
+			FailedAt: time.Now().UTC(),
+		})
+	}
+
+	return valid, q.setAside(src, failed)
+}
+
+// notApplied records the ids the conflict strategy kept out
+func (q *quarantine) notApplied(src *sourceReader, ids []int64) {
+	if len(ids) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.unapplied[src.name] = append(q.unapplied[src.name], ids...)
+}
+
+// counts returns how many records of source were set aside and how
+// many the conflict strategy did not apply
+func (q *quarantine) counts(source string) (int, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.skipped[source]), len(q.unapplied[source])
+}
+
+// setAside records failed entries in the summary and in the store,
+// marked skipped under the skip policy
+func (q *quarantine) setAside(src *sourceReader, failed []quarantineEntry) error {
+	if len(failed) == 0 {
+		return nil
+	}
+
+	status := STATUS_QUARANTINED
+	if q.policy == ERROR_SKIP {
+		status = STATUS_SKIPPED
+	}
+	for i := range failed {
+		failed[i].Status = status
+	}
+	if err := q.store.add(src.sourceID, failed); err != nil {
+		return fmt.Errorf("failed to record %s records: %v", status, err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, entry := range failed {
+		q.skipped[src.name] = append(q.skipped[src.name], entry.LocalID)
+	}
+	return nil
+}
+
+// summary prints the ids set aside and not applied per source
+func (q *quarantine) summary() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	verb := "Skipped"
+	if q.policy == ERROR_QUARANTINE {
+		verb = "Quarantined"
+	}
+	printIDsBySource(q.skipped, verb+" %d records of source %s: %s\n")
+	if len(q.skipped) > 0 {
+		fmt.Println("Retry them with slice sync --retry-quarantine")
+	}
+
+	printIDsBySource(q.unapplied, "Kept existing rows for %d records of source %s under "+q.conflict+": %s\n")
+}
+
+// printIDsBySource prints format with the count, source and id ranges
+// of each source in name order
+func printIDsBySource(ids map[string][]int64, format string) {
+	sources := make([]string, 0, len(ids))
+	for source := range ids {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		list := ids[source]
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+		fmt.Printf(format, len(list), source, formatIDRanges(list))
+	}
+}
+
+// retryQuarantine resends the quarantined records of a source that are
+// still in it and clears the ones that now succeed or no longer exist
+func retryQuarantine(src *sourceReader, dest Destination, q *quarantine, key string, config Config) (int, error) {
+	ids, err := q.store.load(src.sourceID, src.name)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		fmt.Printf("No quarantined records for source %s\n", src.name)
+		return 0, nil
+	}
+
+	// a separate quarantine tells the records failing again apart,
+	// they stay quarantined with their new error
+	retry := &quarantine{policy: ERROR_QUARANTINE, conflict: q.conflict, store: q.store, schema: q.schema, skipped: make(map[string][]int64), unapplied: make(map[string][]int64)}
+
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = DEFAULT_BATCH_SIZE
+	}
+
+	count := 0
+	found := make(map[int64]bool)
+	for start := 0; start < len(ids); start += batchSize {
+		chunk := ids[start:min(start+batchSize, len(ids))]
+		batch, err := readIDs(src, chunk)
+		if err != nil {
+			return count, err
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		for i := range batch {
+			found[batch[i].ID] = true
+		}
+
+		written, err := retry.write(dest, src, batch, key)
+		count += written
+		if err != nil {
+			return count, err
+		}
+	}
+
+	failedAgain := make(map[int64]bool)
+	for _, id := range retry.skipped[src.name] {
+		failedAgain[id] = true
+	}
+	var cleared, missing []int64
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+		if !failedAgain[id] {
+			cleared = append(cleared, id)
+		}
+	}
+
+	if err = q.store.clear(src.sourceID, src.name, cleared); err != nil {
+		return count, err
+	}
+	if len(missing) > 0 {
+		fmt.Printf("Cleared %d quarantined records no longer in source %s: %s\n", len(missing), src.name, formatIDRanges(missing))
+	}
+	if len(failedAgain) > 0 {
+		q.mu.Lock()
+		q.skipped[src.name] = append(q.skipped[src.name], retry.skipped[src.name]...)
+		q.mu.Unlock()
+	}
+	q.notApplied(src, retry.unapplied[src.name])
+	return count, nil
+}
+
+// readIDs reads the source rows with the given ids
+func readIDs(src *sourceReader, ids []int64) ([]Record, error) {
+	where := src.col("id") + " IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := src.db.Query(src.selectSQL(where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SQLite: %v", err)
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		record, err := src.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// tableQuarantine keeps quarantined records in sync_quarantine
+type tableQuarantine struct {
+	db *sql.DB
+}
+
+func (t tableQuarantine) add(sourceID int64, entries []quarantineEntry) error {
+	for _, entry := range entries {
+		_, err := t.db.Exec(`
+            INSERT INTO sync_quarantine (source_id, local_id, file_path, error, failed_at, status)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            ON CONFLICT (source_id, local_id) DO UPDATE
+            SET file_path = EXCLUDED.file_path,
+                error = EXCLUDED.error,
+                failed_at = EXCLUDED.failed_at,
+                status = EXCLUDED.status
+        `, sourceID, entry.LocalID, sanitizeString(entry.FilePath), sanitizeString(entry.Error), entry.FailedAt, entry.Status)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t tableQuarantine) load(sourceID int64, source string) ([]int64, error) {
+	rows, err := t.db.Query("SELECT local_id FROM sync_quarantine WHERE source_id = $1 ORDER BY local_id", sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load quarantine: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (t tableQuarantine) clear(sourceID int64, source string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := t.db.Exec("DELETE FROM sync_quarantine WHERE source_id = $1 AND local_id = ANY($2)", sourceID, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to clear quarantine: %v", err)
+	}
+	return nil
+}
+
+// fileQuarantine appends quarantined records to a jsonl file, one
+// entry per line, and rewrites it when entries are cleared. A record
+// that fails again is appended again, the last entry wins
+type fileQuarantine struct {
+	path string
+	mu   gosync.Mutex
+}
+
+func (f *fileQuarantine) add(sourceID int64, entries []quarantineEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fileQuarantine) read() ([]quarantineEntry, error) {
+	file, err := os.Open(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open quarantine file: %v", err)
+	}
+	defer file.Close()
+
+	var entries []quarantineEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry quarantineEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid quarantine entry in %s: %v", f.path, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func (f *fileQuarantine) load(sourceID int64, source string) ([]int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int64]bool)
+	var ids []int64
+	for _, entry := range entries {
+		if entry.Source == source && !seen[entry.LocalID] {
+			seen[entry.LocalID] = true
+			ids = append(ids, entry.LocalID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (f *fileQuarantine) clear(sourceID int64, source string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	drop := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+
+	type key struct {
+		source string
+		id     int64
+	}
+	last := make(map[key]int, len(entries))
+	for i, entry := range entries {
+		last[key{entry.Source, entry.LocalID}] = i
+	}
+
+	file, err := os.Create(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+	for i, entry := range entries {
+		if last[key{entry.Source, entry.LocalID}] != i {
+			continue
+		}
+		if entry.Source == source && drop[entry.LocalID] {
+			continue
+		}
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestIsRecordError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		conflict string
+		want     bool
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, CONFLICT_SOURCE_WINS, true},
+		{"unique violation under fail", &pq.Error{Code: "23505"}, CONFLICT_FAIL, false},
+		{"not null violation under fail", &pq.Error{Code: "23502"}, CONFLICT_FAIL, true},
+		{"sqlite unique under fail", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, CONFLICT_FAIL, false},
+		{"sqlite not null under fail", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintNotNull}, CONFLICT_FAIL, true},
+		{"invalid byte sequence", &pq.Error{Code: "22021"}, "", true},
+		{"wrapped data exception", fmt.Errorf("failed to insert/update record: %w", &pq.Error{Code: "22P02"}), "", true},
+		{"undefined table", &pq.Error{Code: "42P01"}, "", false},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, "", false},
+		{"failed transaction", &pq.Error{Code: "25P02"}, "", false},
+		{"sqlite constraint", fmt.Errorf("failed to commit batch: %w", sqlite3.Error{Code: sqlite3.ErrConstraint}), "", true},
+		{"sqlite busy", sqlite3.Error{Code: sqlite3.ErrBusy}, "", false},
+		{"bad connection", fmt.Errorf("failed to copy batch: %w", driver.ErrBadConn), "", false},
+		{"plain error", errors.New("boom"), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRecordError(tt.err, tt.conflict); got != tt.want {
+				t.Errorf("isRecordError(%v, %q) = %v, want %v", tt.err, tt.conflict, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteConflictFailIsFatal(t *testing.T) {
+	dest, sourceID := openTestDest(t, CONFLICT_FAIL)
+	src := &sourceReader{name: "src", sourceID: sourceID}
+	existing := []Record{{ID: 1, FilePath: "a.txt", Content: "a"}}
+	if _, err := dest.WriteBatch(sourceID, existing, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range []string{ERROR_SKIP, ERROR_QUARANTINE} {
+		t.Run(policy, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "quarantine.jsonl")
+			q, err := newQuarantine(policy, CONFLICT_FAIL, file, dest, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			batch := []Record{{ID: 2, FilePath: "b.txt", Content: "b"}, {ID: 1, FilePath: "a.txt", Content: "changed"}}
+			if _, err := q.write(dest, src, batch, ""); err == nil {
+				t.Fatal("write succeeded over an existing row under CONFLICT_FAIL")
+			}
+			if skipped, _ := q.counts("src"); skipped != 0 {
+				t.Errorf("%d records set aside, want the conflict to abort instead", skipped)
+			}
+			if _, err := os.Stat(file); !os.IsNotExist(err) {
+				t.Errorf("quarantine file written: %v", err)
+			}
+			if got := destRows(t, dest)["a.txt"]; got != "1:a" {
+				t.Errorf("existing row = %q, want it untouched", got)
+			}
+		})
+	}
+}
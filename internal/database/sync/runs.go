@@ -0,0 +1,195 @@
+package sync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// runInfo describes a sync run when it starts
+type runInfo struct {
+	Source  string
+	Path    string
+	Digest  string
+	Version string
+	Flags   map[string]string
+}
+
+// runCounts are the records of a run by outcome
+type runCounts struct {
+	Written    int
+	NotApplied int
+	Skipped    int
+	Deleted    int
+}
+
+// stampRun sets sync_run_id on the records of a batch the conflict
+// strategy applied
+func stampRun(tx *sql.Tx, runID, sourceID int64, records []Record, unapplied []int64) error {
+	skip := make(map[int64]bool, len(unapplied))
+	for _, id := range unapplied {
+		skip[id] = true
+	}
+	paths := make([]string, 0, len(records))
+	for i := range records {
+		if !skip[records[i].ID] {
+			paths = append(paths, sanitizeString(records[i].FilePath))
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec("UPDATE documents SET sync_run_id = $1 WHERE source_id = $2 AND file_path = ANY($3)", runID, sourceID, pq.Array(paths))
+	if err != nil {
+		return fmt.Errorf("failed to stamp run %d: %v", runID, err)
+	}
+	return nil
+}
+
+// syncRun is one row of sync_runs
+type syncRun struct {
+	ID         int64
+	Source     string
+	Status     string
+	Host       string
+	Username   string
+	Pid        int64
+	Version    string
+	Path       string
+	Digest     string
+	Flags      string
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	Written    int64
+	NotApplied int64
+	Skipped    int64
+	Deleted    int64
+	Error      string
+}
+
+const runColumns = `id, source, status, COALESCE(host, ''), COALESCE(username, ''), COALESCE(pid, 0),
+               COALESCE(version, ''), COALESCE(source_path, ''), COALESCE(source_digest, ''),
+               COALESCE(flags::text, ''), started_at, finished_at, COALESCE(written, 0),
+               COALESCE(not_applied, 0), COALESCE(skipped, 0), COALESCE(deleted, 0), COALESCE(error, '')`
+
+func scanRun(rows *sql.Rows) (syncRun, error) {
+	var r syncRun
+	err := rows.Scan(&r.ID, &r.Source, &r.Status, &r.Host, &r.Username, &r.Pid, &r.Version, &r.Path, &r.Digest,
+		&r.Flags, &r.StartedAt, &r.FinishedAt, &r.Written, &r.NotApplied, &r.Skipped, &r.Deleted, &r.Error)
+	if err != nil {
+		return r, fmt.Errorf("failed to scan sync run: %v", err)
+	}
+	return r, nil
+}
+
+// duration is how long the run took, or has been running
+func (r syncRun) duration() time.Duration {
+	end := time.Now()
+	if r.FinishedAt != nil {
+		end = *r.FinishedAt
+	}
+	return end.Sub(r.StartedAt).Round(time.Second)
+}
+
+// PrintHistory lists the latest runs, newest first. An empty source
+// lists every source
+func PrintHistory(pgDB *sql.DB, source string, limit int) error {
+	query := "SELECT " + runColumns + " FROM sync_runs"
+	args := []any{limit}
+	if source != "" {
+		query += " WHERE source = $2"
+		args = append(args, source)
+	}
+	query += " ORDER BY started_at DESC, id DESC LIMIT $1"
+
+	rows, err := pgDB.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query sync runs: %v", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-6d %-20s %-9s %s  %8s  %s@%s  written %d, not applied %d, skipped %d, deleted %d\n",
+			r.ID, r.Source, r.Status, r.StartedAt.Local().Format(time.DateTime), r.duration(), r.Username, r.Host,
+			r.Written, r.NotApplied, r.Skipped, r.Deleted)
+		if r.Error != "" {
+			fmt.Printf("       error: %s\n", r.Error)
+		}
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if n == 0 {
+		fmt.Println("no sync runs recorded")
+	}
+	return nil
+}
+
+// PrintRun writes every detail of one run to w
+func PrintRun(w io.Writer, pgDB *sql.DB, id int64) error {
+	rows, err := pgDB.Query("SELECT "+runColumns+" FROM sync_runs WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to query sync runs: %v", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("no sync run %d", id)
+	}
+	r, err := scanRun(rows)
+	if err != nil {
+		return err
+	}
+	r.write(w)
+	return nil
+}
+
+// write prints the details of the run, flags sorted by name
+func (r syncRun) write(w io.Writer) {
+	fmt.Fprintf(w, "run:      %d\n", r.ID)
+	fmt.Fprintf(w, "source:   %s\n", r.Source)
+	fmt.Fprintf(w, "path:     %s\n", r.Path)
+	fmt.Fprintf(w, "digest:   %s\n", r.Digest)
+	fmt.Fprintf(w, "status:   %s\n", r.Status)
+	fmt.Fprintf(w, "started:  %s\n", r.StartedAt.Local().Format(time.RFC3339))
+	if r.FinishedAt != nil {
+		fmt.Fprintf(w, "finished: %s (%s)\n", r.FinishedAt.Local().Format(time.RFC3339), r.duration())
+	}
+	fmt.Fprintf(w, "by:       %s@%s pid %d\n", r.Username, r.Host, r.Pid)
+	fmt.Fprintf(w, "version:  %s\n", r.Version)
+	fmt.Fprintf(w, "records:  written %d, not applied %d, skipped %d, deleted %d\n", r.Written, r.NotApplied, r.Skipped, r.Deleted)
+	if r.Error != "" {
+		fmt.Fprintf(w, "error:    %s\n", r.Error)
+	}
+
+	var flags map[string]string
+	if r.Flags != "" && json.Unmarshal([]byte(r.Flags), &flags) == nil && len(flags) > 0 {
+		names := make([]string, 0, len(flags))
+		for name := range flags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = fmt.Sprintf("--%s=%s", name, flags[name])
+		}
+		fmt.Fprintf(w, "flags:    %s\n", strings.Join(parts, " "))
+	}
+}
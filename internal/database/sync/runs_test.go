@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncRunWrite(t *testing.T) {
+	started := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	finished := started.Add(90 * time.Second)
+	run := syncRun{
+		ID:         12,
+		Source:     "reports",
+		Status:     "failed",
+		Host:       "worker1",
+		Username:   "ana",
+		Pid:        77,
+		Version:    "1.4.0",
+		Path:       "/data/reports.db",
+		Digest:     "abc",
+		Flags:      `{"workers": "4", "conflict": "fail"}`,
+		StartedAt:  started,
+		FinishedAt: &finished,
+		Written:    10,
+		NotApplied: 2,
+		Skipped:    1,
+		Error:      "duplicate key",
+	}
+
+	var b strings.Builder
+	run.write(&b)
+	want := strings.Join([]string{
+		"run:      12",
+		"source:   reports",
+		"path:     /data/reports.db",
+		"digest:   abc",
+		"status:   failed",
+		"started:  " + started.Local().Format(time.RFC3339),
+		"finished: " + finished.Local().Format(time.RFC3339) + " (1m30s)",
+		"by:       ana@worker1 pid 77",
+		"version:  1.4.0",
+		"records:  written 10, not applied 2, skipped 1, deleted 0",
+		"error:    duplicate key",
+		"flags:    --conflict=fail --workers=4",
+		"",
+	}, "\n")
+	if got := b.String(); got != want {
+		t.Errorf("write() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSyncRunWriteRunning(t *testing.T) {
+	run := syncRun{ID: 3, Source: "reports", Status: "running", StartedAt: time.Now(), Flags: "{}"}
+
+	var b strings.Builder
+	run.write(&b)
+	got := b.String()
+	for _, line := range []string{"finished:", "error:", "flags:"} {
+		if strings.Contains(got, line) {
+			t.Errorf("write() of a running run printed %q:\n%s", line, got)
+		}
+	}
+	if !strings.Contains(got, "status:   running\n") {
+		t.Errorf("write() = %q, want the running status", got)
+	}
+}
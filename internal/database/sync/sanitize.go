@@ -0,0 +1,227 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Sanitization rules that can be switched on with Config.Sanitize.
+// NUL bytes are always removed since postgres rejects them outright
+const (
+	SANITIZE_UTF8    = "utf8"
+	SANITIZE_CONTROL = "control"
+	SANITIZE_NFC     = "nfc"
+)
+
+// DEFAULT_SANITIZE covers what makes postgres reject a row. Control
+// characters are accepted by postgres and stay unless asked for
+var DEFAULT_SANITIZE = []string{SANITIZE_UTF8}
+
+// rule names the sanitizer counts records under
+const (
+	countNUL       = "nul"
+	countUTF16     = "utf16"
+	countCharset   = "charset"
+	countUTF8      = "utf8"
+	countControl   = "control"
+	countNFC       = "nfc"
+	countMaxLength = "max_length"
+)
+
+// sanitizer cleans every text value read from a source and counts how
+// many records each rule changed. It is shared by concurrent workers
+type sanitizer struct {
+	rules    map[string]bool
+	charset  encoding.Encoding
+	maxBytes int
+	counts   map[string]*atomic.Int64
+}
+
+// newSanitizer builds the pipeline. charset names the encoding text
+// that is not valid UTF-8 is transcoded from, empty replaces invalid
+// sequences instead. maxBytes truncates content, 0 leaves it whole
+func newSanitizer(rules []string, charset string, maxBytes int) (*sanitizer, error) {
+	s := &sanitizer{rules: make(map[string]bool), maxBytes: maxBytes, counts: make(map[string]*atomic.Int64)}
+
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		switch rule {
+		case "":
+		case SANITIZE_UTF8, SANITIZE_CONTROL, SANITIZE_NFC:
+			s.rules[rule] = true
+		default:
+			return nil, fmt.Errorf("unknown sanitize rule %q, expected %s, %s or %s", rule, SANITIZE_UTF8, SANITIZE_CONTROL, SANITIZE_NFC)
+		}
+	}
+
+	switch strings.ToLower(charset) {
+	case "", "utf8", "utf-8":
+	case "latin1", "latin-1", "iso-8859-1":
+		s.charset = charmap.ISO8859_1
+	case "windows-1252", "cp1252":
+		s.charset = charmap.Windows1252
+	default:
+		return nil, fmt.Errorf("unknown charset %q, expected utf-8, latin1 or windows-1252", charset)
+	}
+	if s.charset != nil && !s.rules[SANITIZE_UTF8] {
+		return nil, fmt.Errorf("--charset needs the %s sanitize rule", SANITIZE_UTF8)
+	}
+
+	for _, name := range []string{countNUL, countUTF16, countCharset, countUTF8, countControl, countNFC, countMaxLength} {
+		s.counts[name] = new(atomic.Int64)
+	}
+	return s, nil
+}
+
+// text cleans one value of target field, adding the rules that changed
+// it to touched. touched may be nil when nothing is counted
+func (s *sanitizer) text(field, value string, touched map[string]bool) string {
+	mark := func(rule string) {
+		if touched != nil {
+			touched[rule] = true
+		}
+	}
+
+	if s.rules[SANITIZE_UTF8] {
+		// UTF-16 is full of NUL bytes so it is decoded before they go
+		if decoded, ok := decodeUTF16(value); ok {
+			value = decoded
+			mark(countUTF16)
+		} else if !utf8.ValidString(value) {
+			if s.charset != nil {
+				if transcoded, err := s.charset.NewDecoder().String(value); err == nil {
+					value = transcoded
+					mark(countCharset)
+				}
+			}
+			if !utf8.ValidString(value) {
+				value = strings.ToValidUTF8(value, "\uFFFD")
+				mark(countUTF8)
+			}
+		}
+	}
+
+	if strings.IndexByte(value, 0) >= 0 {
+		value = sanitizeString(value)
+		mark(countNUL)
+	}
+
+	if s.rules[SANITIZE_CONTROL] {
+		if stripped := stripControl(value); stripped != value {
+			value = stripped
+			mark(countControl)
+		}
+	}
+
+	if s.rules[SANITIZE_NFC] && !norm.NFC.IsNormalString(value) {
+		value = norm.NFC.String(value)
+		mark(countNFC)
+	}
+
+	if field == "content" && s.maxBytes > 0 && len(value) > s.maxBytes {
+		value = truncateUTF8(value, s.maxBytes)
+		mark(countMaxLength)
+	}
+
+	return value
+}
+
+// record counts one record against every rule that touched it
+func (s *sanitizer) record(touched map[string]bool) {
+	for rule := range touched {
+		s.counts[rule].Add(1)
+	}
+}
+
+// summary lists the records changed per rule, empty when none were
+func (s *sanitizer) summary() string {
+	var parts []string
+	for name, count := range s.counts {
+		if n := count.Load(); n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", name, n))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// decodeUTF16 decodes text with a UTF-16 byte order mark, or without
+// one when every other byte is NUL as in UTF-16 encoded ASCII
+func decodeUTF16(value string) (string, bool) {
+	b := []byte(value)
+	if len(b) < 2 || len(b)%2 != 0 {
+		return "", false
+	}
+
+	var bigEndian bool
+	switch {
+	case b[0] == 0xFF && b[1] == 0xFE:
+		b = b[2:]
+	case b[0] == 0xFE && b[1] == 0xFF:
+		b = b[2:]
+		bigEndian = true
+	default:
+		if len(b) < 4 {
+			return "", false
+		}
+		var evenNUL, oddNUL int
+		for i := 0; i < len(b); i += 2 {
+			if b[i] == 0 {
+				evenNUL++
+			}
+			if b[i+1] == 0 {
+				oddNUL++
+			}
+		}
+		half := len(b) / 2
+		switch {
+		case oddNUL == half && evenNUL == 0:
+		case evenNUL == half && oddNUL == 0:
+			bigEndian = true
+		default:
+			return "", false
+		}
+	}
+
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		} else {
+			units[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+		}
+	}
+	// lone surrogates decode to U+FFFD
+	return string(utf16.Decode(units)), true
+}
+
+// stripControl removes C0 and C1 control characters other than tab,
+// newline, carriage return and form feed, which marks page breaks in
+// extracted content
+func stripControl(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t', r == '\n', r == '\r', r == '\f':
+			return r
+		case r < 0x20, r == 0x7F, r >= 0x80 && r <= 0x9F:
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// truncateUTF8 cuts value to at most n bytes without splitting a rune
+func truncateUTF8(value string, n int) string {
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return value[:n]
+}
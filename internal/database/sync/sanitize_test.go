@@ -0,0 +1,101 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeUTF16(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"little endian bom", "\xff\xfeh\x00i\x00", "hi", true},
+		{"big endian bom", "\xfe\xff\x00h\x00i", "hi", true},
+		{"little endian without bom", "a\x00b\x00", "ab", true},
+		{"big endian without bom", "\x00a\x00b", "ab", true},
+		{"non ascii", "\xff\xfe\xe9\x00", "é", true},
+		{"lone surrogate", "\xff\xfe\x00\xd8", "�", true},
+		{"odd length", "\xff\xfeh", "", false},
+		{"too short without bom", "a\x00", "", false},
+		{"plain text", "abcd", "", false},
+		{"mixed nuls", "a\x00\x00b", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := decodeUTF16(tt.in)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("decodeUTF16(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSanitizerText(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []string
+		charset  string
+		maxBytes int
+		field    string
+		in       string
+		want     string
+		touched  []string
+	}{
+		{"clean text", DEFAULT_SANITIZE, "", 0, "content", "hello", "hello", nil},
+		{"nul always removed", nil, "", 0, "content", "a\x00b", "ab", []string{countNUL}},
+		{"invalid utf8 replaced", DEFAULT_SANITIZE, "", 0, "content", "a\xffb", "a�b", []string{countUTF8}},
+		{"invalid utf8 kept without rule", nil, "", 0, "content", "a\xffb", "a\xffb", nil},
+		{"latin1 transcoded", DEFAULT_SANITIZE, "latin1", 0, "content", "caf\xe9", "café", []string{countCharset}},
+		{"utf16 decoded", DEFAULT_SANITIZE, "", 0, "content", "\xff\xfeh\x00i\x00", "hi", []string{countUTF16}},
+		{"control kept by default", DEFAULT_SANITIZE, "", 0, "content", "a\x07b\fc", "a\x07b\fc", nil},
+		{"control stripped on request", []string{"utf8", "control"}, "", 0, "content", "a\x07b\u0085c\td\n", "abc\td\n", []string{countControl}},
+		{"form feed survives control", []string{"control"}, "", 0, "content", "page 1\fpage 2", "page 1\fpage 2", nil},
+		{"nfc", []string{"nfc"}, "", 0, "content", "e\u0301", "\u00e9", []string{countNFC}},
+		{"max length on content", nil, "", 3, "content", "héllo", "hé", []string{countMaxLength}},
+		{"max length spares other fields", nil, "", 3, "file_path", "hello", "hello", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSanitizer(tt.rules, tt.charset, tt.maxBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			touched := make(map[string]bool)
+			if got := s.text(tt.field, tt.in, touched); got != tt.want {
+				t.Errorf("text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			want := make(map[string]bool)
+			for _, rule := range tt.touched {
+				want[rule] = true
+			}
+			if !reflect.DeepEqual(touched, want) {
+				t.Errorf("text(%q) touched %v, want %v", tt.in, touched, want)
+			}
+		})
+	}
+}
+
+func TestNewSanitizerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		charset string
+	}{
+		{"unknown rule", []string{"ascii"}, ""},
+		{"unknown charset", DEFAULT_SANITIZE, "ebcdic"},
+		{"charset without utf8", []string{"control"}, "latin1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSanitizer(tt.rules, tt.charset, 0); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DEFAULT_COLLECTION holds the sources synced without --collection
+const DEFAULT_COLLECTION = "default"
+
+// sourceNames derives a stable source identifier for each sqlite db
+// from its file name, so worker3.db is always source worker3
+func sourceNames(paths []string, override string) ([]string, error) {
+	if override != "" {
+		if len(paths) > 1 {
+			return nil, fmt.Errorf("--source-name needs a single sqlite db, %d matched", len(paths))
+		}
+		return []string{override}, nil
+	}
+
+	names := make([]string, len(paths))
+	seen := make(map[string]string)
+	for i, path := range paths {
+		base := filepath.Base(path)
+		name := strings.TrimSuffix(base, filepath.Ext(base))
+		if prev, ok := seen[name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be source %s", prev, path, name)
+		}
+		seen[name] = path
+		names[i] = name
+	}
+	return names, nil
+}
+
+// registerSource returns the id of a source, creating it on first
+// sync and recording the path it was last synced from
+func registerSource(pgDB *sql.DB, name, sqlitePath string) (int64, error) {
+	abs, err := filepath.Abs(sqlitePath)
+	if err != nil {
+		abs = sqlitePath
+	}
+
+	var id int64
+	err = pgDB.QueryRow(`
+        INSERT INTO sync_sources (name, path) VALUES ($1, $2)
+        ON CONFLICT (name) DO UPDATE SET path = EXCLUDED.path
+        RETURNING id
+    `, name, abs).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to register source %s: %v", name, err)
+	}
+	return id, nil
+}
+
+// lookupSource returns the id of a source without registering it, 0
+// when it was never synced
+func lookupSource(pgDB *sql.DB, name string) (int64, error) {
+	var id int64
+	err := pgDB.QueryRow("SELECT id FROM sync_sources WHERE name = $1", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up source %s: %v", name, err)
+	}
+	return id, nil
+}
+
+// claimCollection puts a source in collection. A source with documents
+// stays in its collection, so one dataset cannot be mixed into another
+// by syncing it under the same name. An empty collection keeps the
+// source where it is
+func claimCollection(pgDB *sql.DB, sourceID int64, name, collection string) error {
+	if collection == "" {
+		return nil
+	}
+
+	result, err := pgDB.Exec(`
+        UPDATE sync_sources SET collection = $2
+        WHERE id = $1 AND (collection = $2 OR NOT EXISTS (SELECT 1 FROM documents WHERE source_id = $1))
+    `, sourceID, collection)
+	if err != nil {
+		return fmt.Errorf("failed to set the collection of source %s: %v", name, err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	var current string
+	if err := pgDB.QueryRow("SELECT collection FROM sync_sources WHERE id = $1", sourceID).Scan(&current); err != nil {
+		return fmt.Errorf("failed to look up the collection of source %s: %v", name, err)
+	}
+	return fmt.Errorf("source %s already has documents in collection %s, use another --source-name to sync it into %s",
+		name, current, collection)
+}
+
+// PrintCollections lists every collection with its sources and live
+// documents
+func PrintCollections(pgDB *sql.DB) error {
+	rows, err := pgDB.Query(`
+        SELECT s.collection, COUNT(DISTINCT s.id), COUNT(d.id)
+        FROM sync_sources s
+        LEFT JOIN documents d ON d.source_id = s.id AND d.deleted_at IS NULL
+        GROUP BY s.collection
+        ORDER BY s.collection
+    `)
+	if err != nil {
+		return fmt.Errorf("failed to query collections: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var collection string
+		var sources, documents int64
+		if err := rows.Scan(&collection, &sources, &documents); err != nil {
+			return fmt.Errorf("failed to scan collection: %v", err)
+		}
+		fmt.Printf("%-24s %6d sources %10d documents\n", collection, sources, documents)
+	}
+	return rows.Err()
+}
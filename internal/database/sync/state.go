@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+)
+
+// syncState is the high-water mark of the last successful sync of a
+// source. Watermark is a digest of the path rules and of id,
+// content_hash and extraction_version for every source row up to
+// LastID, so a change to an already synced row can be detected
+// without reading content
+type syncState struct {
+	Source    string
+	LastID    int64
+	Watermark string
+}
+
+// loadState returns the state of the last sync of source, or nil if
+// it was never synced
+func loadState(pgDB *sql.DB, source string) (*syncState, error) {
+	state := syncState{Source: source}
+	err := pgDB.QueryRow("SELECT last_id, watermark FROM sync_state WHERE source = $1", source).
+		Scan(&state.LastID, &state.Watermark)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync state: %v", err)
+	}
+	return &state, nil
+}
+
+func saveState(pgDB *sql.DB, state syncState) error {
+	_, err := pgDB.Exec(`
+        INSERT INTO sync_state (source, last_id, watermark, synced_at)
+        VALUES ($1, $2, $3, now())
+        ON CONFLICT (source) DO UPDATE
+        SET last_id = EXCLUDED.last_id,
+            watermark = EXCLUDED.watermark,
+            synced_at = EXCLUDED.synced_at
+    `, state.Source, state.LastID, state.Watermark)
+	if err != nil {
+		return fmt.Errorf("failed to save sync state: %v", err)
+	}
+	return nil
+}
+
+// sourceWatermark computes the watermark over every source row within
+// bounds and returns the highest id seen alongside the digest
+func sourceWatermark(src *sourceReader, bounds idRange) (string, int64, error) {
+	id := src.col("id")
+	query := fmt.Sprintf("SELECT %s, %s, %s FROM %s", id, src.col("content_hash"), src.col("extraction_version"), quoteIdent(src.table))
+	where, args := bounds.where(id)
+	if where != "" {
+		query += " WHERE " + where
+	}
+	query += " ORDER BY " + id
+
+	rows, err := src.db.Query(query, args...)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to query SQLite: %v", err)
+	}
+	defer rows.Close()
+
+	h := sha256.New()
+	if src.paths != nil {
+		src.paths.writeRules(h)
+	}
+	var maxID int64
+	for rows.Next() {
+		var id int64
+		var hash sql.NullString
+		var version sql.NullInt64
+		if err := rows.Scan(&id, &hash, &version); err != nil {
+			return "", 0, fmt.Errorf("failed to scan row: %v", err)
+		}
+		fmt.Fprintf(h, "%d|%s|%d\n", id, hash.String, version.Int64)
+		maxID = id
+	}
+	if err := rows.Err(); err != nil {
+		return "", 0, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), maxID, nil
+}
+
+// remoteKey is what a synced row is compared on to tell whether it changed
+type remoteKey struct {
+	Path    string
+	Hash    string
+	Version int64
+	// Canonical is the path the rules rewrote it to, so a change to
+	// the rules resends the rows it moves
+	Canonical string
+}
+
+// recordKey builds the comparison key for a source record. Rows
+// without a content_hash are compared on the md5 of their content
+func recordKey(record *Record) remoteKey {
+	key := remoteKey{Path: sanitizeString(record.FilePath)}
+	if record.ContentHash != nil {
+		key.Hash = sanitizeString(*record.ContentHash)
+	} else {
+		sum := md5.Sum([]byte(sanitizeString(record.Content)))
+		key.Hash = hex.EncodeToString(sum[:])
+	}
+	if record.ExtractionVersion != nil {
+		key.Version = *record.ExtractionVersion
+	}
+	if canonical := canonicalPath(record); canonical != nil {
+		key.Canonical = *canonical
+	}
+	return key
+}
+
+// remoteKeys loads the comparison key of every remote row of the
+// source within bounds up to lastID, keyed by local id
+func remoteKeys(pgDB *sql.DB, src *sourceReader, bounds idRange, lastID int64) (map[int64]remoteKey, error) {
+	bounds = bounds.atMost(lastID)
+	query := `
+        SELECT local_id, file_path, COALESCE(content_hash, md5(content)), COALESCE(extraction_version, 0),
+               COALESCE(canonical_path, '')
+        FROM documents
+        WHERE source_id = $1 AND local_id <= $2 AND deleted_at IS NULL`
+	args := []any{src.sourceID, bounds.Upto}
+	if bounds.HasAfter {
+		query += " AND local_id > $3"
+		args = append(args, bounds.After)
+	}
+
+	rows, err := pgDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query PostgreSQL: %v", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[int64]remoteKey)
+	for rows.Next() {
+		var id int64
+		var key remoteKey
+		if err := rows.Scan(&id, &key.Path, &key.Hash, &key.Version, &key.Canonical); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		keys[id] = key
+	}
+
+	return keys, rows.Err()
+}
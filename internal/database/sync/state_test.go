@@ -0,0 +1,163 @@
+package sync
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// openVersionedSource creates a source with content_hash and
+// extraction_version columns holding rows 1 to 3
+func openVersionedSource(t *testing.T) *sourceReader {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "src.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+        CREATE TABLE documents (id INTEGER, file_path TEXT, content TEXT, content_hash TEXT, extraction_version INTEGER);
+        INSERT INTO documents VALUES (1, 'a', 'x', 'h1', 1), (2, 'b', 'x', 'h2', 1), (3, 'c', 'x', NULL, NULL);
+    `)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := newSourceReader(db, DefaultMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func TestSourceWatermark(t *testing.T) {
+	tests := []struct {
+		name   string
+		change string
+		// bounds the watermark covers
+		bounds idRange
+		want   bool
+	}{
+		{"unchanged", "", idRange{}.atMost(2), false},
+		{"hash changed", "UPDATE documents SET content_hash = 'h9' WHERE id = 2", idRange{}.atMost(2), true},
+		{"version changed", "UPDATE documents SET extraction_version = 2 WHERE id = 1", idRange{}.atMost(2), true},
+		{"row removed", "DELETE FROM documents WHERE id = 1", idRange{}.atMost(2), true},
+		{"content alone", "UPDATE documents SET content = 'y' WHERE id = 1", idRange{}.atMost(2), false},
+		{"newer row changed", "UPDATE documents SET content_hash = 'h9' WHERE id = 3", idRange{}.atMost(2), false},
+		{"newer row added", "INSERT INTO documents VALUES (4, 'd', 'x', 'h4', 1)", idRange{}.atMost(2), false},
+		{"whole table", "INSERT INTO documents VALUES (4, 'd', 'x', 'h4', 1)", idRange{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := openVersionedSource(t)
+			before, maxID, err := sourceWatermark(src, tt.bounds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.bounds.HasUpto && maxID != 3 {
+				t.Errorf("sourceWatermark() max id = %d, want 3", maxID)
+			}
+
+			if tt.change != "" {
+				if _, err := src.db.Exec(tt.change); err != nil {
+					t.Fatal(err)
+				}
+			}
+			after, _, err := sourceWatermark(src, tt.bounds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed := after != before; changed != tt.want {
+				t.Errorf("watermark changed %v, want %v", changed, tt.want)
+			}
+		})
+	}
+}
+
+func TestForEachBatchAfterWatermark(t *testing.T) {
+	src := openVersionedSource(t)
+	watermark, _, err := sourceWatermark(src, idRange{}.atMost(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// with the rows up to the high-water mark unchanged only newer
+	// rows are read, without state every row is
+	tests := []struct {
+		name  string
+		state *syncState
+		want  []int64
+	}{
+		{"no state", nil, []int64{1, 2, 3}},
+		{"unchanged", &syncState{Source: "src", LastID: 2, Watermark: watermark}, []int64{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int64
+			read, err := forEachBatch(src, nil, tt.state, idRange{}, 2, func(batch []Record) error {
+				for _, r := range batch {
+					got = append(got, r.ID)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || read != len(tt.want) {
+				t.Errorf("forEachBatch() read %d rows %v, want %v", read, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordKeyCanonicalPath(t *testing.T) {
+	record := Record{ID: 1, FilePath: `C:\data\a.txt`, Content: "body"}
+	before := recordKey(&record)
+
+	record.CanonicalPath = "a.txt"
+	if after := recordKey(&record); after == before {
+		t.Errorf("recordKey() = %+v after a path rule applied, want it to differ", after)
+	}
+}
+
+func TestSourceWatermarkPathRules(t *testing.T) {
+	mapping := DefaultMapping()
+	mapping.Columns["path"] = ColumnMapping{Target: "file_path"}
+	src := openTestSource(t, mapping, map[int64]string{1: "/mnt/a.txt", 2: "/mnt/b.txt"})
+
+	watermark := func(rules PathRules) string {
+		t.Helper()
+		src.paths = nil
+		if len(rules.Prefix) > 0 || len(rules.Regex) > 0 {
+			paths, err := newPathRewriter(rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src.paths = paths
+		}
+		digest, maxID, err := sourceWatermark(src, idRange{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if maxID != 2 {
+			t.Errorf("sourceWatermark() max id = %d, want 2", maxID)
+		}
+		return digest
+	}
+
+	none := watermark(PathRules{})
+	mnt := watermark(PathRules{Prefix: []PrefixRule{{From: "/mnt", To: ""}}})
+	data := watermark(PathRules{Prefix: []PrefixRule{{From: "/mnt", To: "data"}}})
+	regex := watermark(PathRules{Regex: []RegexRule{{Pattern: `\.txt$`, Replace: ".text"}}})
+
+	if none == mnt || mnt == data || none == regex || mnt == regex {
+		t.Errorf("watermarks do not follow the path rules: %s %s %s %s", none, mnt, data, regex)
+	}
+	if again := watermark(PathRules{Prefix: []PrefixRule{{From: "/mnt/", To: ""}}}); again != mnt {
+		t.Errorf("watermark changed with an equivalent rule: %s, want %s", again, mnt)
+	}
+}
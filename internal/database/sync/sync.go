@@ -5,15 +5,93 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"slice/cmd/utils"
 	"strings"
+	"sync/atomic"
 
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+const DEFAULT_BATCH_SIZE = 1000
+
 type Config struct {
 	SQLiteDBPath string
 	PostgresDSN  string
+	// Full ignores the high-water mark and resends every row
+	Full bool
+	// Method is either METHOD_COPY or METHOD_ROW
+	Method    string
+	BatchSize int
+	// DeleteMode is DELETE_NONE, DELETE_HARD or DELETE_TOMBSTONE
+	DeleteMode   string
+	MaxDeletePct float64
+	// Mapping selects and maps source columns by name
+	Mapping Mapping
+	// PathRules rewrite each file_path into the canonical_path stored
+	// next to it
+	PathRules PathRules
+	// DryRun prints a Plan in PlanFormat, text or json, instead of
+	// writing, json as one array of the plans of every source.
+	// PlanSample caps the ids listed per outcome
+	DryRun     bool
+	PlanFormat string
+	PlanSample int
+	// Resume continues an interrupted sync from its checkpoint
+	Resume bool
+	// Workers syncs that many id ranges concurrently, each on its own
+	// postgres connection
+	Workers int
+	// SourceName overrides the source identifier of a single sqlite
+	// db, which defaults to its file name without extension
+	SourceName string
+	// Dest is where rows are written, see openDestination. Empty
+	// means postgres at PostgresDSN
+	Dest string
+	// OnError is ERROR_ABORT, ERROR_SKIP or ERROR_QUARANTINE.
+	// QuarantineFile overrides where quarantined records are kept and
+	// RetryQuarantine resends them instead of syncing
+	OnError         string
+	QuarantineFile  string
+	RetryQuarantine bool
+	// Sanitize lists the SANITIZE_* rules applied to every text value.
+	// Charset is what invalid UTF-8 is transcoded from, empty replaces
+	// it, and MaxContentBytes truncates content when above 0
+	Sanitize        []string
+	Charset         string
+	MaxContentBytes int
+	// Verify compares each source with postgres after syncing it, in
+	// id ranges of VerifyRangeSize
+	Verify          bool
+	VerifyRangeSize int
+	// Conflict is the CONFLICT_* strategy for rows already in the
+	// destination, empty is DEFAULT_CONFLICT
+	Conflict string
+	// ListDelimiter splits urls, names, places and tokens that are not
+	// JSON arrays, empty detects it. EntityTables also fills
+	// document_urls and document_entities on postgres
+	ListDelimiter string
+	EntityTables  bool
+	// MetadataSchema is a JSON Schema file every non-NULL metadata
+	// value must match, failures go through the OnError policy
+	MetadataSchema string
+	// Wait blocks until another sync of the same source releases its
+	// lock instead of failing
+	Wait bool
+	// Version and Flags are recorded with each run in sync_runs.
+	// StampRun also sets documents.sync_run_id on every row written
+	Version  string
+	Flags    map[string]string
+	StampRun bool
+
+	// Collection puts the synced sources in a collection, empty keeps
+	// each source in its own and new ones in DEFAULT_COLLECTION
+	Collection string
+
+	// runID is the sync_runs row of the source being synced, set when
+	// StampRun is
+	runID int64
 }
 
 // sanitizeString removes null bytes from a string
@@ -47,152 +125,533 @@ type Record struct {
 	Tokens            *string `json:"tokens,omitempty"`
 	Places            *string `json:"places,omitempty"`
 	Metadata          *string `json:"metadata,omitempty"`
+	// The list fields are parsed from Urls, Names, Places and Tokens
+	UrlList   []string `json:"-"`
+	NameList  []string `json:"-"`
+	PlaceList []string `json:"-"`
+	TokenList []string `json:"-"`
+	// CanonicalPath is FilePath rewritten by the path rules
+	CanonicalPath string `json:"canonical_path,omitempty"`
 }
 
-func SyncWithRemote(sqlitePath string) {
-	config := Config{
-		SQLiteDBPath: sqlitePath,
-		PostgresDSN:  os.Getenv("DB_CONN_STRING"),
+// SyncWithRemote syncs every sqlite db matching config.SQLiteDBPath,
+// which may be a glob, into the destination one source after another
+func SyncWithRemote(config Config) {
+	paths, err := filepath.Glob(config.SQLiteDBPath)
+	if err != nil {
+		log.Fatal("Invalid sqlite path:", err)
+	}
+	if len(paths) == 0 {
+		log.Fatalf("no sqlite db matches %s", config.SQLiteDBPath)
+	}
+
+	names, err := sourceNames(paths, config.SourceName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if config.Conflict == "" {
+		config.Conflict = DEFAULT_CONFLICT
+	}
+	if err = checkConflict(config.Conflict); err != nil {
+		log.Fatal(err)
+	}
+
+	if err = checkDestPath(config.Dest, paths); err != nil {
+		log.Fatal(err)
+	}
+
+	if strings.HasPrefix(config.Dest, "postgres://") || strings.HasPrefix(config.Dest, "postgresql://") {
+		// workers open their own connections with PostgresDSN
+		config.PostgresDSN = config.Dest
+	}
+
+	dest, err := openDestination(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, ok := dest.(incrementalDestination); !ok {
+		if err = checkFileDestConfig(config); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// records that fail again on a retry stay quarantined
+	policy := config.OnError
+	if config.RetryQuarantine {
+		policy = ERROR_QUARANTINE
+	}
+	q, err := newQuarantine(policy, config.Conflict, config.QuarantineFile, dest, config.Dest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config.MetadataSchema != "" {
+		if q.schema, err = loadMetadataSchema(config.MetadataSchema); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if config.DeleteMode != "" && config.DeleteMode != DELETE_NONE &&
+		config.DeleteMode != DELETE_HARD && config.DeleteMode != DELETE_TOMBSTONE {
+		log.Fatalf("unknown delete mode %q, expected %s, %s or %s", config.DeleteMode, DELETE_NONE, DELETE_HARD, DELETE_TOMBSTONE)
 	}
 
+	if config.Mapping.Table == "" {
+		config.Mapping = DefaultMapping()
+	}
+
+	clean, err := newSanitizer(config.Sanitize, config.Charset, config.MaxContentBytes)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rewrite, err := newPathRewriter(config.PathRules)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// a json plan owns stdout, so it stays one parseable document
+	jsonPlan := config.DryRun && config.PlanFormat == "json"
+	progress := os.Stdout
+	if jsonPlan {
+		progress = os.Stderr
+	}
+
+	var plans []*Plan
+	for i, path := range paths {
+		if len(paths) > 1 {
+			fmt.Fprintf(progress, "Syncing %s as source %s (%d/%d)\n", path, names[i], i+1, len(paths))
+		}
+		if err = syncSource(dest, q, clean, rewrite, path, names[i], config, &plans); err != nil {
+			log.Fatalf("Sync of %s failed: %v", path, err)
+		}
+	}
+	if jsonPlan {
+		if err = writePlans(os.Stdout, plans); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err = dest.Close(); err != nil {
+		log.Fatal("Failed to close destination:", err)
+	}
+	q.summary()
+	if q.schema != nil {
+		q.schema.report()
+	}
+	if summary := clean.summary(); summary != "" {
+		log.Printf("Sanitized records per rule: %s\n", summary)
+	}
+
+	// a file destination already reported what it wrote
+	if !config.DryRun && isIncremental(dest) {
+		fmt.Println("Database migration completed successfully!")
+	}
+}
+
+// checkDestPath refuses a file destination that is also one of the
+// sources, which a glob over the destination's own directory matches
+func checkDestPath(dest string, paths []string) error {
+	if dest == "" || strings.Contains(dest, "://") {
+		return nil
+	}
+	destAbs, err := filepath.Abs(dest)
+	if err != nil {
+		return nil
+	}
+	for _, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil && abs == destAbs {
+			return fmt.Errorf("destination %s is also matched as a source", dest)
+		}
+	}
+	return nil
+}
+
+// checkFileDestConfig rejects options that need the sync state only an
+// incremental destination keeps
+func checkFileDestConfig(config Config) error {
+	var unsupported []string
+	if config.DeleteMode != "" && config.DeleteMode != DELETE_NONE {
+		unsupported = append(unsupported, "--delete")
+	}
+	if config.DryRun {
+		unsupported = append(unsupported, "--dry-run")
+	}
+	if config.Resume {
+		unsupported = append(unsupported, "--resume")
+	}
+	if config.Workers > 1 {
+		unsupported = append(unsupported, "--workers")
+	}
+	if config.Verify {
+		unsupported = append(unsupported, "--verify")
+	}
+	if config.EntityTables {
+		unsupported = append(unsupported, "--entity-tables")
+	}
+	if config.StampRun {
+		unsupported = append(unsupported, "--stamp-run")
+	}
+	if config.Collection != "" {
+		unsupported = append(unsupported, "--collection")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%s need a postgres destination", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// syncSource syncs one sqlite db registered under name. A dry run
+// prints its text plan, a json plan is added to plans for the caller
+// to print with the others
+func syncSource(dest Destination, q *quarantine, clean *sanitizer, rewrite *pathRewriter, sqlitePath, name string, config Config, plans *[]*Plan) (err error) {
 	// Connect to SQLite
-	sqliteDB, err := sql.Open("sqlite3", config.SQLiteDBPath)
+	sqliteDB, err := sql.Open("sqlite3", sqlitePath)
 	if err != nil {
-		log.Fatal("Failed to connect to SQLite:", err)
+		return fmt.Errorf("failed to connect to SQLite: %v", err)
 	}
 	defer sqliteDB.Close()
 
-	// Connect to PostgreSQL
-	pgDB, err := sql.Open("postgres", config.PostgresDSN)
+	if err = sqliteDB.Ping(); err != nil {
+		return fmt.Errorf("SQLite ping failed: %v", err)
+	}
+
+	src, err := newSourceReader(sqliteDB, config.Mapping)
 	if err != nil {
-		log.Fatal("Failed to connect to PostgreSQL:", err)
+		return err
 	}
-	defer pgDB.Close()
 
-	// Verify connections
-	if err = sqliteDB.Ping(); err != nil {
-		log.Fatal("SQLite ping failed:", err)
+	src.name = name
+	src.clean = clean
+	src.listDelimiter = config.ListDelimiter
+	src.paths = rewrite
+
+	// documents are keyed on the path, checked over the whole source
+	// before any worker writes its range
+	paths, err := src.readPaths()
+	if err != nil {
+		return err
+	}
+
+	if inc, ok := dest.(incrementalDestination); ok && config.DryRun {
+		// a dry run writes nothing, an unknown source plans as all
+		// inserts under id 0
+		src.sourceID, err = lookupSource(inc.remote(), name)
+	} else {
+		src.sourceID, err = dest.RegisterSource(name, sqlitePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Concurrent syncs of a source would interleave batches and
+	// checkpoints, a dry run writes nothing so it does not lock. The
+	// lock holder's sync_runs row is also the run's history
+	var counts runCounts
+	if inc, ok := dest.(incrementalDestination); ok && !config.DryRun {
+		// the digest matches a run to the exact file it read
+		digest, digestErr := utils.FileDigest(sqlitePath)
+		if digestErr != nil {
+			return digestErr
+		}
+		run := runInfo{Source: name, Path: sqlitePath, Digest: digest, Version: config.Version, Flags: config.Flags}
+		lock, lockErr := acquireLock(inc.remote(), run, config.Wait)
+		if lockErr != nil {
+			return lockErr
+		}
+		defer func() {
+			counts.Skipped, counts.NotApplied = q.counts(name)
+			lock.release(counts, err)
+		}()
+
+		if config.StampRun {
+			config.runID = lock.runID
+			dest = inc.forRun(lock.runID)
+		}
+	}
+
+	if config.RetryQuarantine {
+		// a separate checkpoint key keeps the retry from moving the
+		// checkpoint of an interrupted sync
+		key := name + "#quarantine"
+		count, err := retryQuarantine(src, dest, q, key, config)
+		counts.Written = count
+		if err != nil {
+			return fmt.Errorf("quarantine retry failed: %v", err)
+		}
+		if inc, ok := dest.(incrementalDestination); ok {
+			if err = clearCheckpoint(inc.remote(), key); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Resent %d quarantined records\n", count)
+		return nil
+	}
+
+	// Without sync state every row is sent each time
+	inc, ok := dest.(incrementalDestination)
+	if !ok {
+		var progress atomic.Int64
+		count, err := migrateData(src, dest, q, nil, idRange{}, name, config, &progress)
+		if err != nil {
+			return fmt.Errorf("export failed: %v", err)
+		}
+		fmt.Printf("Wrote %d records to %s\n", count, config.Dest)
+		return nil
 	}
-	if err = pgDB.Ping(); err != nil {
-		log.Fatal("PostgreSQL ping failed:", err)
+	pgDB := inc.remote()
+
+	var state *syncState
+	if !config.Full {
+		state, err = loadState(pgDB, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Work out deletions before writing anything so the safety
+	// threshold can abort a sync against the wrong source
+	var deletedIDs, deleted []int64
+	var deleteAbort error
+	if config.DeleteMode != "" && config.DeleteMode != DELETE_NONE {
+		var remote int
+		deletedIDs, deleted, remote, err = findDeleted(paths, src.sourceID, pgDB)
+		if err != nil {
+			return err
+		}
+		deleteAbort = checkDeleteThreshold(deleted, remote, config.MaxDeletePct)
+		if deleteAbort != nil && !config.DryRun {
+			return deleteAbort
+		}
+	}
+
+	if config.DryRun {
+		minID, _, err := idBounds(src)
+		if err != nil {
+			return err
+		}
+		floor := sql.NullInt64{Int64: minID.Int64 - 1, Valid: minID.Valid}
+		bounds, err := resumeRanges(pgDB, name, []idRange{{}}, floor, config.Resume)
+		if err != nil {
+			return err
+		}
+		plan, err := buildPlan(src, pgDB, state, bounds[0], config, deleted, deleteAbort)
+		if err != nil {
+			return fmt.Errorf("dry run failed: %v", err)
+		}
+		if config.PlanFormat == "json" {
+			*plans = append(*plans, plan)
+			return nil
+		}
+		return plan.Write(os.Stdout)
 	}
 
 	// Migrate data
-	err = migrateData(sqliteDB, pgDB)
+	count, err := syncRanges(src, inc, q, state, name, config)
+	counts.Written = count
+	if err != nil {
+		return fmt.Errorf("migration failed: %v", err)
+	}
+
+	if len(deleted) > 0 {
+		if err = applyDeletes(pgDB, deletedIDs, config.DeleteMode, DEFAULT_BATCH_SIZE); err != nil {
+			return err
+		}
+		counts.Deleted = len(deleted)
+		fmt.Printf("Removed %d records (%s): %s\n", len(deleted), config.DeleteMode, formatIDRanges(deleted))
+	}
+
+	// Move the high-water mark to cover everything now in the source
+	watermark, lastID, err := sourceWatermark(src, idRange{})
 	if err != nil {
-		log.Fatal("Migration failed:", err)
+		return err
+	}
+	err = saveState(pgDB, syncState{Source: name, LastID: lastID, Watermark: watermark})
+	if err != nil {
+		return err
+	}
+	if err = clearCheckpoint(pgDB, name); err != nil {
+		return err
 	}
 
-	fmt.Println("Database migration completed successfully!")
+	fmt.Printf("Synced %d new or changed records\n", count)
+
+	if config.Verify {
+		// a fresh sanitizer keeps the reread out of the sync's counts
+		verify := *src
+		verify.clean, _ = newSanitizer(config.Sanitize, config.Charset, config.MaxContentBytes)
+		report, err := verifySource(&verify, pgDB, config.VerifyRangeSize)
+		if err != nil {
+			return fmt.Errorf("verification failed: %v", err)
+		}
+		report.Print()
+		if len(report.Differ) > 0 {
+			return fmt.Errorf("verification found %d of %d id ranges differing", len(report.Differ), report.Ranges)
+		}
+	}
+	return nil
 }
 
-func migrateData(sqliteDB, pgDB *sql.DB) error {
-	rows, err := sqliteDB.Query("SELECT * FROM documents")
+// sourceQuery picks which source rows need sending. Without state every
+// row is sent and pgDB may be nil. When the rows up to the high-water
+// mark are unchanged only newer rows are read, otherwise every row is
+// read and the ones matching the remote copy are skipped. Only rows
+// within bounds are read
+func sourceQuery(src *sourceReader, pgDB *sql.DB, state *syncState, bounds idRange) (string, []any, func(*Record) bool, error) {
+	where, args := bounds.where(src.col("id"))
+
+	if state == nil {
+		// a file destination keeps no sync state to find
+		if pgDB != nil {
+			log.Println("No previous sync found, sending every row")
+		}
+		return src.selectSQL(where), args, nil, nil
+	}
+
+	watermark, _, err := sourceWatermark(src, idRange{}.atMost(state.LastID))
 	if err != nil {
-		return fmt.Errorf("failed to query SQLite: %v", err)
+		return "", nil, nil, err
 	}
-	defer rows.Close()
 
-	tx, err := pgDB.Begin()
+	if watermark == state.Watermark {
+		log.Printf("No changes up to id %d, sending newer rows\n", state.LastID)
+		newer, newerArgs := bounds.above(state.LastID).where(src.col("id"))
+		return src.selectSQL(newer), newerArgs, nil, nil
+	}
+
+	log.Printf("Rows up to id %d changed since the last sync, comparing with remote\n", state.LastID)
+	keys, err := remoteKeys(pgDB, src, bounds, state.LastID)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return "", nil, nil, err
+	}
+	skip := func(record *Record) bool {
+		key, ok := keys[record.ID]
+		return ok && key == recordKey(record)
 	}
+	return src.selectSQL(where), args, skip, nil
+}
 
-	stmt, err := tx.Prepare(`
-        INSERT INTO documents (id, file_path, file_type, content, content_hash, extraction_version, urls, names, tokens, places, metadata)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-        ON CONFLICT (id) DO UPDATE
-        SET file_path = EXCLUDED.file_path,
-            file_type = EXCLUDED.file_type,
-            content = EXCLUDED.content,
-            content_hash = EXCLUDED.content_hash,
-            extraction_version = EXCLUDED.extraction_version,
-	    urls = EXCLUDED.urls,
-	    names = EXCLUDED.names,
-	    tokens = EXCLUDED.tokens,
-	    places = EXCLUDED.places,
-            metadata = EXCLUDED.metadata
-    `)
+// forEachBatch reads the source rows that need sending and calls fn
+// with each full batch and the final partial one. It returns the
+// number of rows read, those change detection skipped included
+func forEachBatch(src *sourceReader, pgDB *sql.DB, state *syncState, bounds idRange, batchSize int, fn func([]Record) error) (int, error) {
+	query, args, skip, err := sourceQuery(src, pgDB, state, bounds)
 	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %v", err)
+		return 0, err
 	}
-	defer stmt.Close()
 
-	batchSize := 1000
-	count := 0
-	var record Record
+	rows, err := src.db.Query(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query SQLite: %v", err)
+	}
+	defer rows.Close()
+
+	if batchSize <= 0 {
+		batchSize = DEFAULT_BATCH_SIZE
+	}
+	batch := make([]Record, 0, batchSize)
 
+	// rows come in id order, so a repeated id follows its first copy
+	var prevID int64
+	first := true
+	read := 0
 	for rows.Next() {
-		err = rows.Scan(&record.ID,
-			&record.FilePath,
-			&record.FileType,
-			&record.Content,
-			&record.ContentHash,
-			&record.ExtractionVersion,
-			&record.Urls,
-			&record.Names,
-			&record.Tokens,
-			&record.Places,
-			&record.Metadata)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to scan row: %v", err)
-		}
-
-		// Sanitize the data before insertion
-		_, err = stmt.Exec(record.ID,
-			sanitizeString(record.FilePath),
-			sanitizeNullString(record.FileType),
-			sanitizeString(record.Content),
-			sanitizeNullString(record.ContentHash),
-			record.ExtractionVersion,
-			sanitizeNullString(record.Urls),
-			sanitizeNullString(record.Names),
-			sanitizeNullString(record.Tokens),
-			sanitizeNullString(record.Places),
-			sanitizeNullString(record.Metadata))
+		record, err := src.scan(rows)
 		if err != nil {
-			tx.Rollback()
-			log.Printf("Error processing record ID %d: %v\nFilePath: %s\n", record.ID, err, record.FilePath)
-			return fmt.Errorf("failed to insert/update record %d: %v", record.ID, err)
+			return read, err
+		}
+		if !first && record.ID == prevID {
+			return read, fmt.Errorf("id %d appears more than once in %s, the column mapped to id must be unique", record.ID, src.table)
 		}
+		prevID, first = record.ID, false
+		read++
 
-		count++
-		if count%batchSize == 0 {
-			err = tx.Commit()
-			if err != nil {
-				return fmt.Errorf("failed to commit batch: %v", err)
-			}
-			tx, err = pgDB.Begin()
-			if err != nil {
-				return fmt.Errorf("failed to begin new transaction: %v", err)
-			}
-			stmt, err = tx.Prepare(`
-                INSERT INTO documents (id, file_path, file_type, content, content_hash, extraction_version, urls, names, tokens, places, metadata)
-                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-                ON CONFLICT (id) DO UPDATE
-                SET file_path = EXCLUDED.file_path,
-                    file_type = EXCLUDED.file_type,
-                    content = EXCLUDED.content,
-                    content_hash = EXCLUDED.content_hash,
-                    extraction_version = EXCLUDED.extraction_version,
-		    urls = EXCLUDED.urls,
-		    names = EXCLUDED.names,
-		    tokens = EXCLUDED.tokens,
-		    places = EXCLUDED.places,
-                    metadata = EXCLUDED.metadata
-            `)
-			if err != nil {
-				return fmt.Errorf("failed to prepare statement: %v", err)
+		if skip != nil && skip(&record) {
+			continue
+		}
+
+		batch = append(batch, record)
+		if len(batch) == batchSize {
+			if err = fn(batch); err != nil {
+				return read, err
 			}
-			fmt.Printf("Processed %d records\n", count)
+			batch = batch[:0]
 		}
 	}
 
 	if err = rows.Err(); err != nil {
+		return read, fmt.Errorf("row iteration error: %v", err)
+	}
+
+	if len(batch) > 0 {
+		return read, fn(batch)
+	}
+	return read, nil
+}
+
+// migrateData syncs the rows within bounds to dest, checkpointing
+// under key, and hands failed batches to q. state is nil unless dest
+// is incremental. progress is shared by all workers and counts
+// committed rows
+func migrateData(src *sourceReader, dest Destination, q *quarantine, state *syncState, bounds idRange, key string, config Config, progress *atomic.Int64) (int, error) {
+	var pgDB *sql.DB
+	if inc, ok := dest.(incrementalDestination); ok {
+		pgDB = inc.remote()
+	}
+
+	count := 0
+	_, err := forEachBatch(src, pgDB, state, bounds, config.BatchSize, func(batch []Record) error {
+		written, err := q.write(dest, src, batch, key)
+		if err != nil {
+			return err
+		}
+		count += written
+		fmt.Printf("Processed %d records\n", progress.Add(int64(written)))
+		return nil
+	})
+
+	return count, err
+}
+
+// commitBatch writes a batch in its own transaction along with the
+// checkpoint for source and returns the ids the conflict strategy did
+// not apply. If a COPY batch fails it is retried once with the row by
+// row path
+func commitBatch(pgDB *sql.DB, writer batchWriter, batch []Record, source string) ([]int64, error) {
+	unapplied, err := writeInTx(pgDB, writer, batch, source)
+	if err == nil {
+		return unapplied, nil
+	}
+
+	cw, ok := writer.(copyWriter)
+	if !ok {
+		return nil, err
+	}
+
+	log.Printf("COPY failed for batch %d-%d: %v, retrying row by row\n", batch[0].ID, batch[len(batch)-1].ID, err)
+	return writeInTx(pgDB, rowWriter{sourceID: cw.sourceID, conflict: cw.conflict, entities: cw.entities, runID: cw.runID}, batch, source)
+}
+
+func writeInTx(pgDB *sql.DB, writer batchWriter, batch []Record, source string) ([]int64, error) {
+	tx, err := pgDB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+
+	unapplied, err := writer.writeBatch(tx, batch)
+	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("row iteration error: %v", err)
+		return nil, err
 	}
 
-	return tx.Commit()
+	if err = saveCheckpoint(tx, source, batch[len(batch)-1].ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit batch: %w", err)
+	}
+	return unapplied, nil
 }
@@ -0,0 +1,257 @@
+package sync
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+)
+
+const DEFAULT_VERIFY_RANGE = 10000
+
+// rangeSum is the row count and checksum of the rows in one id range
+type rangeSum struct {
+	Count int
+	Sum   string
+}
+
+// rangeDiff is an id range whose rows differ between source and remote
+type rangeDiff struct {
+	From, To int64
+	// a side without rows in the range has a zero rangeSum
+	Source rangeSum
+	Remote rangeSum
+}
+
+// verifyReport compares one source with its remote rows
+type verifyReport struct {
+	Source     string
+	SourceRows int
+	RemoteRows int
+	Ranges     int
+	Differ     []rangeDiff
+}
+
+// rangeWidth falls back to DEFAULT_VERIFY_RANGE
+func rangeWidth(width int) int64 {
+	if width <= 0 {
+		return DEFAULT_VERIFY_RANGE
+	}
+	return int64(width)
+}
+
+// sourceRangeSums reads every source row the way a sync would and
+// checksums id, content_hash and extraction_version per id range.
+// Rows without a content_hash use the md5 of their content
+func sourceRangeSums(src *sourceReader, width int64) (map[int64]rangeSum, int, error) {
+	rows, err := src.db.Query(src.selectSQL(""))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query SQLite: %v", err)
+	}
+	defer rows.Close()
+
+	sums := make(map[int64]rangeSum)
+	var bucket int64
+	var lines []byte
+	count, total := 0, 0
+	flush := func() {
+		if count > 0 {
+			sum := md5.Sum(lines)
+			sums[bucket] = rangeSum{Count: count, Sum: hex.EncodeToString(sum[:])}
+		}
+		lines, count = lines[:0], 0
+	}
+
+	for rows.Next() {
+		record, err := src.scan(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if b := record.ID / width; b != bucket || count == 0 {
+			flush()
+			bucket = b
+		}
+		if count > 0 {
+			lines = append(lines, '\n')
+		}
+		key := recordKey(&record)
+		lines = fmt.Appendf(lines, "%d|%s|%d", record.ID, key.Hash, key.Version)
+		count++
+		total++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("row iteration error: %v", err)
+	}
+	flush()
+
+	return sums, total, nil
+}
+
+// remoteRangeSums computes the same checksums in postgres over the
+// live rows of a source
+func remoteRangeSums(pgDB *sql.DB, sourceID int64, width int64) (map[int64]rangeSum, int, error) {
+	rows, err := pgDB.Query(`
+        SELECT local_id / $2, COUNT(*),
+               md5(string_agg(local_id::text || '|' || COALESCE(content_hash, md5(COALESCE(content, ''))) || '|' ||
+                   COALESCE(extraction_version, 0)::text, E'\n' ORDER BY local_id))
+        FROM documents
+        WHERE source_id = $1 AND deleted_at IS NULL
+        GROUP BY 1
+    `, sourceID, width)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query PostgreSQL: %v", err)
+	}
+	defer rows.Close()
+
+	sums := make(map[int64]rangeSum)
+	total := 0
+	for rows.Next() {
+		var bucket int64
+		var sum rangeSum
+		if err := rows.Scan(&bucket, &sum.Count, &sum.Sum); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan row: %v", err)
+		}
+		sums[bucket] = sum
+		total += sum.Count
+	}
+	return sums, total, rows.Err()
+}
+
+// verifySource compares the rows of a synced source with postgres
+func verifySource(src *sourceReader, pgDB *sql.DB, width int) (*verifyReport, error) {
+	w := rangeWidth(width)
+
+	local, localRows, err := sourceRangeSums(src, w)
+	if err != nil {
+		return nil, err
+	}
+	remote, remoteRows, err := remoteRangeSums(pgDB, src.sourceID, w)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &verifyReport{Source: src.name, SourceRows: localRows, RemoteRows: remoteRows}
+	report.Ranges, report.Differ = compareRanges(local, remote, w)
+	return report, nil
+}
+
+// compareRanges returns how many id ranges either side has rows in and
+// the ones that differ, sorted by id
+func compareRanges(local, remote map[int64]rangeSum, width int64) (int, []rangeDiff) {
+	buckets := make(map[int64]bool)
+	for b := range local {
+		buckets[b] = true
+	}
+	for b := range remote {
+		buckets[b] = true
+	}
+
+	var differ []rangeDiff
+	for b := range buckets {
+		if local[b] == remote[b] {
+			continue
+		}
+		differ = append(differ, rangeDiff{From: b * width, To: b*width + width - 1, Source: local[b], Remote: remote[b]})
+	}
+	sort.Slice(differ, func(i, j int) bool { return differ[i].From < differ[j].From })
+
+	return len(buckets), differ
+}
+
+// Print writes the report, one line per differing range
+func (r *verifyReport) Print() {
+	if len(r.Differ) == 0 {
+		fmt.Printf("source %s: %d rows in sqlite, %d in postgres, all %d ranges match\n", r.Source, r.SourceRows, r.RemoteRows, r.Ranges)
+		return
+	}
+
+	fmt.Printf("source %s: %d rows in sqlite, %d in postgres, %d of %d ranges differ\n", r.Source, r.SourceRows, r.RemoteRows, len(r.Differ), r.Ranges)
+	for _, d := range r.Differ {
+		var reason string
+		switch {
+		case d.Remote.Count == 0:
+			reason = fmt.Sprintf("missing from postgres (%d rows in sqlite)", d.Source.Count)
+		case d.Source.Count == 0:
+			reason = fmt.Sprintf("not in sqlite (%d rows in postgres)", d.Remote.Count)
+		case d.Source.Count != d.Remote.Count:
+			reason = fmt.Sprintf("%d rows in sqlite, %d in postgres", d.Source.Count, d.Remote.Count)
+		default:
+			reason = fmt.Sprintf("checksum differs across %d rows", d.Source.Count)
+		}
+		fmt.Printf("  ids %d-%d: %s\n", d.From, d.To, reason)
+	}
+}
+
+// VerifyWithRemote compares every sqlite db matching
+// config.SQLiteDBPath with the rows synced from it, exiting with an
+// error when any id range differs
+func VerifyWithRemote(pgDB *sql.DB, config Config) {
+	paths, err := filepath.Glob(config.SQLiteDBPath)
+	if err != nil {
+		log.Fatal("Invalid sqlite path:", err)
+	}
+	if len(paths) == 0 {
+		log.Fatalf("no sqlite db matches %s", config.SQLiteDBPath)
+	}
+
+	names, err := sourceNames(paths, config.SourceName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if config.Mapping.Table == "" {
+		config.Mapping = DefaultMapping()
+	}
+
+	clean, err := newSanitizer(config.Sanitize, config.Charset, config.MaxContentBytes)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	failed := 0
+	for i, path := range paths {
+		report, err := verifyPath(pgDB, clean, path, names[i], config)
+		if err != nil {
+			log.Fatalf("Verify of %s failed: %v", path, err)
+		}
+		report.Print()
+		if len(report.Differ) > 0 {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d sources differ from postgres", failed, len(paths))
+	}
+}
+
+// verifyPath opens one sqlite db and verifies it against the source
+// registered under name
+func verifyPath(pgDB *sql.DB, clean *sanitizer, sqlitePath, name string, config Config) (*verifyReport, error) {
+	sqliteDB, err := sql.Open("sqlite3", sqlitePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SQLite: %v", err)
+	}
+	defer sqliteDB.Close()
+
+	src, err := newSourceReader(sqliteDB, config.Mapping)
+	if err != nil {
+		return nil, err
+	}
+	src.name = name
+	src.clean = clean
+
+	src.sourceID, err = lookupSource(pgDB, name)
+	if err != nil {
+		return nil, err
+	}
+	if src.sourceID == 0 {
+		return nil, fmt.Errorf("source %s was never synced", name)
+	}
+
+	return verifySource(src, pgDB, config.VerifyRangeSize)
+}
@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSourceRangeSums(t *testing.T) {
+	mapping := DefaultMapping()
+	mapping.Columns["path"] = ColumnMapping{Target: "file_path"}
+	src := openTestSource(t, mapping, map[int64]string{1: "a", 2: "b", 15: "c"})
+
+	sums, total, err := sourceRangeSums(src, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every row has content 'x' and no hash or version
+	content := md5.Sum([]byte("x"))
+	sum := func(ids ...string) string {
+		var lines []string
+		for _, id := range ids {
+			lines = append(lines, id+"|"+hex.EncodeToString(content[:])+"|0")
+		}
+		s := md5.Sum([]byte(strings.Join(lines, "\n")))
+		return hex.EncodeToString(s[:])
+	}
+	want := map[int64]rangeSum{
+		0: {Count: 2, Sum: sum("1", "2")},
+		1: {Count: 1, Sum: sum("15")},
+	}
+	if total != 3 || !reflect.DeepEqual(sums, want) {
+		t.Errorf("sourceRangeSums() = %v, %d, want %v, 3", sums, total, want)
+	}
+
+	if _, err := src.db.Exec("UPDATE documents SET content = 'y' WHERE id = 15"); err != nil {
+		t.Fatal(err)
+	}
+	changed, _, err := sourceRangeSums(src, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed[0] != sums[0] || changed[1] == sums[1] {
+		t.Errorf("a change to id 15 gave %v, want only range 1 to differ from %v", changed, sums)
+	}
+}
+
+func TestCompareRanges(t *testing.T) {
+	a := rangeSum{Count: 2, Sum: "a"}
+	b := rangeSum{Count: 2, Sum: "b"}
+	c := rangeSum{Count: 1, Sum: "c"}
+
+	local := map[int64]rangeSum{0: a, 1: a, 2: a, 4: c}
+	remote := map[int64]rangeSum{0: a, 1: b, 3: c, 4: a}
+
+	ranges, differ := compareRanges(local, remote, 100)
+	want := []rangeDiff{
+		{From: 100, To: 199, Source: a, Remote: b},
+		{From: 200, To: 299, Source: a},
+		{From: 300, To: 399, Remote: c},
+		{From: 400, To: 499, Source: c, Remote: a},
+	}
+	if ranges != 5 || !reflect.DeepEqual(differ, want) {
+		t.Errorf("compareRanges() = %d, %+v, want 5, %+v", ranges, differ, want)
+	}
+
+	if ranges, differ := compareRanges(nil, nil, 100); ranges != 0 || differ != nil {
+		t.Errorf("compareRanges() of empty sides = %d, %+v, want nothing", ranges, differ)
+	}
+}
@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
+)
+
+// idRange bounds the source ids a sync pass reads. After is exclusive
+// and Upto inclusive, each only when its Has flag is set, so any id
+// can bound a range. The zero value is every id
+type idRange struct {
+	After    int64
+	Upto     int64
+	HasAfter bool
+	HasUpto  bool
+}
+
+// between is the range of ids after after up to upto
+func between(after, upto int64) idRange {
+	return idRange{After: after, Upto: upto, HasAfter: true, HasUpto: true}
+}
+
+// above narrows the range to ids above id
+func (r idRange) above(id int64) idRange {
+	if !r.HasAfter || r.After < id {
+		r.After, r.HasAfter = id, true
+	}
+	return r
+}
+
+// atMost narrows the range to ids up to id
+func (r idRange) atMost(id int64) idRange {
+	if !r.HasUpto || r.Upto > id {
+		r.Upto, r.HasUpto = id, true
+	}
+	return r
+}
+
+// overlaps reports whether the two ranges share an id
+func (r idRange) overlaps(o idRange) bool {
+	return (!r.HasAfter || !o.HasUpto || r.After < o.Upto) &&
+		(!o.HasAfter || !r.HasUpto || o.After < r.Upto)
+}
+
+// String describes the ids of the range for messages
+func (r idRange) String() string {
+	switch {
+	case r.HasAfter && r.HasUpto:
+		return fmt.Sprintf("ids %d-%d", r.After+1, r.Upto)
+	case r.HasAfter:
+		return fmt.Sprintf("ids after %d", r.After)
+	case r.HasUpto:
+		return fmt.Sprintf("ids up to %d", r.Upto)
+	}
+	return "all ids"
+}
+
+// where returns the sql condition for the range, empty when it is open
+func (r idRange) where(idCol string) (string, []any) {
+	var conds []string
+	var args []any
+
+	if r.HasAfter {
+		conds = append(conds, idCol+" > ?")
+		args = append(args, r.After)
+	}
+	if r.HasUpto {
+		conds = append(conds, idCol+" <= ?")
+		args = append(args, r.Upto)
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// splitRange divides the ids from minID to maxID into n contiguous ranges
+func splitRange(minID, maxID int64, n int) []idRange {
+	lo := minID - 1
+	width := (maxID - lo + int64(n) - 1) / int64(n)
+	if width < 1 {
+		width = 1
+	}
+
+	var ranges []idRange
+	for after := lo; after < maxID; after += width {
+		ranges = append(ranges, between(after, min(after+width, maxID)))
+	}
+	return ranges
+}
+
+// idBounds returns the lowest and highest source ids, null when the
+// source is empty
+func idBounds(src *sourceReader) (minID, maxID sql.NullInt64, err error) {
+	query := fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s", src.col("id"), src.col("id"), quoteIdent(src.table))
+	if err = src.db.QueryRow(query).Scan(&minID, &maxID); err != nil {
+		err = fmt.Errorf("failed to read SQLite id range: %v", err)
+	}
+	return minID, maxID, err
+}
+
+// syncRanges runs migrateData over the whole source, split across
+// config.Workers concurrent workers. Each worker has its own postgres
+// connection, batches, transactions and checkpoint, and walks its
+// range in id order. Errors from every worker are reported together
+func syncRanges(src *sourceReader, dest incrementalDestination, q *quarantine, state *syncState, source string, config Config) (int, error) {
+	var progress atomic.Int64
+
+	minID, maxID, err := idBounds(src)
+	if err != nil {
+		return 0, err
+	}
+	floor := sql.NullInt64{Int64: minID.Int64 - 1, Valid: minID.Valid}
+
+	if config.Workers <= 1 {
+		bounds, err := startRanges(dest.remote(), source, []idRange{{}}, floor, config.Resume)
+		if err != nil {
+			return 0, err
+		}
+		return migrateData(src, dest, q, state, bounds[0], source, config, &progress)
+	}
+	if !minID.Valid {
+		return 0, nil
+	}
+
+	ranges := splitRange(minID.Int64, maxID.Int64, config.Workers)
+	log.Printf("Syncing ids %d-%d with %d workers\n", minID.Int64, maxID.Int64, len(ranges))
+	starts, err := startRanges(dest.remote(), source, ranges, floor, config.Resume)
+	if err != nil {
+		return 0, err
+	}
+
+	errs := make([]error, len(ranges))
+	var wg gosync.WaitGroup
+	for i, r := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			workerDB, err := sql.Open("postgres", config.PostgresDSN)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: failed to connect to PostgreSQL: %v", r, err)
+				return
+			}
+			defer workerDB.Close()
+			workerDB.SetMaxOpenConns(1)
+
+			// checkpoints are kept under the range as split, the
+			// start may have moved past a resumed checkpoint
+			worker := &postgresDestination{db: workerDB, method: config.Method, conflict: config.Conflict, entities: config.EntityTables, runID: config.runID}
+			_, err = migrateData(src, worker, q, state, starts[i], rangeKey(source, r), config, &progress)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %v", r, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return int(progress.Load()), errors.Join(errs...)
+}
+
+// startRanges resolves where each range starts. A fresh sync drops the
+// checkpoints of an earlier one, a resumed sync mixing them with its
+// own could later skip ids this one never wrote
+func startRanges(pgDB *sql.DB, source string, ranges []idRange, floor sql.NullInt64, resume bool) ([]idRange, error) {
+	starts, err := resumeRanges(pgDB, source, ranges, floor, resume)
+	if err != nil || resume {
+		return starts, err
+	}
+	return starts, clearCheckpoint(pgDB, source)
+}
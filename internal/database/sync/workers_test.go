@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		minID int64
+		maxID int64
+		n     int
+		want  []idRange
+	}{
+		{"even", 1, 100, 4, []idRange{between(0, 25), between(25, 50), between(50, 75), between(75, 100)}},
+		{"uneven", 1, 10, 3, []idRange{between(0, 4), between(4, 8), between(8, 10)}},
+		{"more workers than ids", 5, 7, 8, []idRange{between(4, 5), between(5, 6), between(6, 7)}},
+		{"single id", 3, 3, 4, []idRange{between(2, 3)}},
+		{"one worker", 10, 20, 1, []idRange{between(9, 20)}},
+		{"from zero", 0, 5, 2, []idRange{between(-1, 2), between(2, 5)}},
+		{"negative ids", -5, 4, 2, []idRange{between(-6, -1), between(-1, 4)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitRange(tt.minID, tt.maxID, tt.n)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitRange(%d, %d, %d) = %v, want %v", tt.minID, tt.maxID, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIDRangeWhere(t *testing.T) {
+	tests := []struct {
+		name     string
+		r        idRange
+		want     string
+		wantArgs []any
+	}{
+		{"open", idRange{}, "", nil},
+		{"bounded", between(0, 25), "id > ? AND id <= ?", []any{int64(0), int64(25)}},
+		{"minus one is an id", between(-1, -1), "id > ? AND id <= ?", []any{int64(-1), int64(-1)}},
+		{"above", idRange{}.above(-1), "id > ?", []any{int64(-1)}},
+		{"above keeps the higher start", between(10, 25).above(5), "id > ? AND id <= ?", []any{int64(10), int64(25)}},
+		{"at most", idRange{}.atMost(-3), "id <= ?", []any{int64(-3)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := tt.r.where("id")
+			if got != tt.want || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("where() = %q, %v, want %q, %v", got, args, tt.want, tt.wantArgs)
+			}
+		})
+	}
+}
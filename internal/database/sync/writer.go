@@ -0,0 +1,278 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	METHOD_COPY = "copy"
+	METHOD_ROW  = "row"
+)
+
+// Conflict strategies for a source row whose natural key already
+// exists in documents
+const (
+	CONFLICT_SOURCE_WINS   = "source-wins"
+	CONFLICT_NEWER_WINS    = "newer-extraction-wins"
+	CONFLICT_SKIP_EXISTING = "skip-existing"
+	CONFLICT_FAIL          = "fail"
+	DEFAULT_CONFLICT       = CONFLICT_SOURCE_WINS
+)
+
+// checkConflict validates a conflict strategy, empty is source-wins
+func checkConflict(strategy string) error {
+	switch strategy {
+	case "", CONFLICT_SOURCE_WINS, CONFLICT_NEWER_WINS, CONFLICT_SKIP_EXISTING, CONFLICT_FAIL:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict strategy %q, expected %s, %s, %s or %s",
+		strategy, CONFLICT_SOURCE_WINS, CONFLICT_NEWER_WINS, CONFLICT_SKIP_EXISTING, CONFLICT_FAIL)
+}
+
+// documentColumns are the columns written to documents, in the order
+// recordValues returns them. documents.id is assigned by postgres and
+// the source's own id is kept in local_id
+var documentColumns = []string{"source_id", "local_id", "file_path", "file_type", "content", "content_hash",
+	"extraction_version", "urls", "names", "tokens", "places", "metadata",
+	"url_list", "name_list", "place_list", "token_list", "metadata_json", "canonical_path"}
+
+// conflictColumns is the natural key a source row is matched on. The
+// path survives a re-extraction that renumbers the source's ids, so
+// local_id is not part of it and a source may not repeat a path
+var conflictColumns = []string{"source_id", "file_path"}
+
+// recordValues sanitizes a record into the values for documentColumns
+func recordValues(sourceID int64, record *Record) []any {
+	return []any{sourceID,
+		record.ID,
+		sanitizeString(record.FilePath),
+		sanitizeNullString(record.FileType),
+		sanitizeString(record.Content),
+		sanitizeNullString(record.ContentHash),
+		record.ExtractionVersion,
+		sanitizeNullString(record.Urls),
+		sanitizeNullString(record.Names),
+		sanitizeNullString(record.Tokens),
+		sanitizeNullString(record.Places),
+		sanitizeNullString(record.Metadata),
+		pq.Array(record.UrlList),
+		pq.Array(record.NameList),
+		pq.Array(record.PlaceList),
+		pq.Array(record.TokenList),
+		metadataJSON(record.Metadata),
+		canonicalPath(record)}
+}
+
+// canonicalPath stores an empty canonical path as NULL
+func canonicalPath(record *Record) *string {
+	if record.CanonicalPath == "" {
+		return nil
+	}
+	return sanitizeNullString(&record.CanonicalPath)
+}
+
+// conflictSQL is the ON CONFLICT clause shared by both write methods.
+// Rows the strategy keeps are left out of the affected rows, fail has
+// no clause so the unique violation aborts the batch
+func conflictSQL(strategy string) string {
+	switch strategy {
+	case CONFLICT_SKIP_EXISTING:
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(conflictColumns, ", "))
+	case CONFLICT_FAIL:
+		return ""
+	}
+
+	var set []string
+	for _, col := range documentColumns {
+		if slices.Contains(conflictColumns, col) {
+			continue
+		}
+		set = append(set, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+	}
+	// a row coming back to the source revives its tombstone
+	set = append(set, "deleted_at = NULL")
+
+	clause := fmt.Sprintf(`ON CONFLICT (%s) DO UPDATE
+        SET %s`, strings.Join(conflictColumns, ", "), strings.Join(set, ",\n            "))
+	if strategy == CONFLICT_NEWER_WINS {
+		// equal versions are a resync of the same extraction and apply
+		clause += `
+        WHERE COALESCE(documents.extraction_version, 0) <= COALESCE(EXCLUDED.extraction_version, 0)`
+	}
+	return clause
+}
+
+// upsertSQL inserts or updates a single row
+func upsertSQL(strategy string) string {
+	placeholders := make([]string, len(documentColumns))
+	for i := range documentColumns {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	return fmt.Sprintf(`
+        INSERT INTO documents (%s)
+        VALUES (%s)
+        %s
+    `, strings.Join(documentColumns, ", "), strings.Join(placeholders, ", "), conflictSQL(strategy))
+}
+
+// batchWriter writes one batch of records inside a transaction and
+// returns the ids of the records the conflict strategy did not apply
+type batchWriter interface {
+	writeBatch(tx *sql.Tx, records []Record) ([]int64, error)
+}
+
+// newBatchWriter returns the writer for a sync method. entities also
+// refreshes the child tables of the written rows, a non zero runID is
+// stamped on the rows applied
+func newBatchWriter(method string, sourceID int64, conflict string, entities bool, runID int64) (batchWriter, error) {
+	switch method {
+	case METHOD_COPY:
+		return copyWriter{sourceID: sourceID, conflict: conflict, entities: entities, runID: runID}, nil
+	case METHOD_ROW:
+		return rowWriter{sourceID: sourceID, conflict: conflict, entities: entities, runID: runID}, nil
+	default:
+		return nil, fmt.Errorf("unknown sync method %q, expected %s or %s", method, METHOD_COPY, METHOD_ROW)
+	}
+}
+
+// rowWriter upserts one row per statement
+type rowWriter struct {
+	sourceID int64
+	conflict string
+	entities bool
+	runID    int64
+}
+
+func (w rowWriter) writeBatch(tx *sql.Tx, records []Record) ([]int64, error) {
+	stmt, err := tx.Prepare(upsertSQL(w.conflict))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %v", err)
+	}
+	defer stmt.Close()
+
+	var unapplied []int64
+	for i := range records {
+		result, err := stmt.Exec(recordValues(w.sourceID, &records[i])...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert/update record %d: %w", records[i].ID, err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			unapplied = append(unapplied, records[i].ID)
+		}
+	}
+
+	if w.entities {
+		if err = refreshEntities(tx, w.sourceID, records); err != nil {
+			return nil, err
+		}
+	}
+	if w.runID != 0 {
+		if err = stampRun(tx, w.runID, w.sourceID, records, unapplied); err != nil {
+			return nil, err
+		}
+	}
+	return unapplied, nil
+}
+
+// copyWriter streams the batch into a temporary staging table with
+// COPY and merges it into documents with a single statement
+type copyWriter struct {
+	sourceID int64
+	conflict string
+	entities bool
+	runID    int64
+}
+
+func (w copyWriter) writeBatch(tx *sql.Tx, records []Record) ([]int64, error) {
+	// Temporary tables live per connection, so create it in every
+	// transaction in case the pool hands out a new one. Only the
+	// written columns are copied so the staging table takes no ids
+	// from the documents sequence
+	_, err := tx.Exec(fmt.Sprintf(`
+        CREATE TEMP TABLE IF NOT EXISTS documents_staging ON COMMIT DELETE ROWS
+        AS SELECT %s FROM documents WITH NO DATA
+    `, strings.Join(documentColumns, ", ")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging table: %v", err)
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("documents_staging", documentColumns...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start copy: %v", err)
+	}
+
+	for i := range records {
+		_, err = stmt.Exec(recordValues(w.sourceID, &records[i])...)
+		if err != nil {
+			stmt.Close()
+			return nil, fmt.Errorf("failed to copy record %d: %w", records[i].ID, err)
+		}
+	}
+
+	// Flush the copy buffer
+	if _, err = stmt.Exec(); err != nil {
+		stmt.Close()
+		return nil, fmt.Errorf("failed to copy batch: %w", err)
+	}
+	if err = stmt.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish copy: %w", err)
+	}
+
+	rows, err := tx.Query(mergeSQL(w.conflict))
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge staging table: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool, len(records))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to merge staging table: %w", err)
+		}
+		applied[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to merge staging table: %w", err)
+	}
+
+	rows.Close()
+
+	var unapplied []int64
+	for i := range records {
+		if !applied[records[i].ID] {
+			unapplied = append(unapplied, records[i].ID)
+		}
+	}
+
+	if w.entities {
+		if err = refreshEntities(tx, w.sourceID, records); err != nil {
+			return nil, err
+		}
+	}
+	if w.runID != 0 {
+		if err = stampRun(tx, w.runID, w.sourceID, records, unapplied); err != nil {
+			return nil, err
+		}
+	}
+	return unapplied, nil
+}
+
+// mergeSQL moves the staged rows into documents with the same conflict
+// handling as upsertSQL, returning the local ids it applied
+func mergeSQL(strategy string) string {
+	cols := strings.Join(documentColumns, ", ")
+
+	return fmt.Sprintf(`
+        INSERT INTO documents (%s)
+        SELECT %s FROM documents_staging
+        %s
+        RETURNING local_id
+    `, cols, cols, conflictSQL(strategy))
+}
@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openTestDest opens a sqlite consolidation destination with one
+// registered source, it runs the same upsert as postgres
+func openTestDest(t *testing.T, conflict string) (*sqliteDestination, int64) {
+	t.Helper()
+	dest, err := openSQLite(filepath.Join(t.TempDir(), "dest.db"), conflict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dest.Close() })
+
+	sourceID, err := dest.RegisterSource("src", "src.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dest, sourceID
+}
+
+// destRows returns local_id and content of every document by path
+func destRows(t *testing.T, dest *sqliteDestination) map[string]string {
+	t.Helper()
+	rows, err := dest.db.Query("SELECT file_path, local_id, content FROM documents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	got := make(map[string]string)
+	for rows.Next() {
+		var path, content string
+		var localID int64
+		if err := rows.Scan(&path, &localID, &content); err != nil {
+			t.Fatal(err)
+		}
+		got[path] = fmt.Sprintf("%d:%s", localID, content)
+	}
+	return got
+}
+
+func TestWriteBatchKeysOnPath(t *testing.T) {
+	dest, sourceID := openTestDest(t, CONFLICT_SOURCE_WINS)
+
+	first := []Record{{ID: 1, FilePath: "a.txt", Content: "a"}, {ID: 2, FilePath: "b.txt", Content: "b"}}
+	if _, err := dest.WriteBatch(sourceID, first, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// a re-extraction renumbers the ids, the paths still match
+	renumbered := []Record{{ID: 10, FilePath: "b.txt", Content: "b2"}, {ID: 11, FilePath: "a.txt", Content: "a"}}
+	if _, err := dest.WriteBatch(sourceID, renumbered, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"a.txt": "11:a", "b.txt": "10:b2"}
+	if got := destRows(t, dest); !reflect.DeepEqual(got, want) {
+		t.Errorf("documents = %v, want %v", got, want)
+	}
+}
+
+func TestWriteBatchConflict(t *testing.T) {
+	version := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		strategy string
+		version  *int64
+		want     string
+		wantKept bool
+		wantErr  bool
+	}{
+		{CONFLICT_SOURCE_WINS, version(1), "1:new", false, false},
+		{CONFLICT_NEWER_WINS, version(1), "1:old", true, false},
+		// equal versions are a resync of the same extraction
+		{CONFLICT_NEWER_WINS, version(2), "1:new", false, false},
+		{CONFLICT_NEWER_WINS, version(3), "1:new", false, false},
+		{CONFLICT_NEWER_WINS, nil, "1:old", true, false},
+		{CONFLICT_SKIP_EXISTING, version(3), "1:old", true, false},
+		{CONFLICT_FAIL, version(3), "1:old", false, true},
+	}
+
+	for _, tt := range tests {
+		name := tt.strategy + "/no version"
+		if tt.version != nil {
+			name = fmt.Sprintf("%s/version %d", tt.strategy, *tt.version)
+		}
+		t.Run(name, func(t *testing.T) {
+			dest, sourceID := openTestDest(t, tt.strategy)
+			existing := []Record{{ID: 1, FilePath: "a.txt", Content: "old", ExtractionVersion: version(2)}}
+			if _, err := dest.WriteBatch(sourceID, existing, ""); err != nil {
+				t.Fatal(err)
+			}
+
+			batch := []Record{
+				{ID: 1, FilePath: "a.txt", Content: "new", ExtractionVersion: tt.version},
+				{ID: 2, FilePath: "b.txt", Content: "b"},
+			}
+			unapplied, err := dest.WriteBatch(sourceID, batch, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteBatch() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			want := map[string]string{"a.txt": tt.want, "b.txt": "2:b"}
+			if tt.wantErr {
+				// the failing batch is rolled back as a whole
+				delete(want, "b.txt")
+			}
+			if got := destRows(t, dest); !reflect.DeepEqual(got, want) {
+				t.Errorf("documents = %v, want %v", got, want)
+			}
+			if kept := reflect.DeepEqual(unapplied, []int64{1}); kept != tt.wantKept {
+				t.Errorf("unapplied = %v, want the existing row kept %v", unapplied, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestWriteBatchUpdatesEveryColumn(t *testing.T) {
+	dest, sourceID := openTestDest(t, CONFLICT_SOURCE_WINS)
+	str := func(s string) *string { return &s }
+	version := func(v int64) *int64 { return &v }
+
+	record := func(n int) Record {
+		r := Record{
+			ID:                int64(n),
+			FilePath:          "a.txt",
+			FileType:          str(fmt.Sprintf("type%d", n)),
+			Content:           fmt.Sprintf("content%d", n),
+			ContentHash:       str(fmt.Sprintf("hash%d", n)),
+			ExtractionVersion: version(int64(n)),
+			Urls:              str(fmt.Sprintf("https://%d.org", n)),
+			Names:             str(fmt.Sprintf("name%d", n)),
+			Tokens:            str(fmt.Sprintf("token%d", n)),
+			Places:            str(fmt.Sprintf("place%d", n)),
+			Metadata:          str(fmt.Sprintf(`{"n": %d}`, n)),
+			CanonicalPath:     fmt.Sprintf("docs%d/a.txt", n),
+		}
+		parseLists(&r, "")
+		return r
+	}
+
+	// columns reads every written column of the row as text
+	columns := func() map[string]string {
+		t.Helper()
+		exprs := make([]string, len(documentColumns))
+		for i, col := range documentColumns {
+			exprs[i] = fmt.Sprintf("COALESCE(CAST(%s AS TEXT), 'NULL')", col)
+		}
+		values := make([]string, len(documentColumns))
+		dests := make([]any, len(values))
+		for i := range values {
+			dests[i] = &values[i]
+		}
+		query := fmt.Sprintf("SELECT %s FROM documents WHERE file_path = 'a.txt'", strings.Join(exprs, ", "))
+		if err := dest.db.QueryRow(query).Scan(dests...); err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string, len(values))
+		for i, col := range documentColumns {
+			got[col] = values[i]
+		}
+		return got
+	}
+
+	if _, err := dest.WriteBatch(sourceID, []Record{record(1)}, ""); err != nil {
+		t.Fatal(err)
+	}
+	before := columns()
+	if _, err := dest.db.Exec("UPDATE documents SET deleted_at = '2025-01-01'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dest.WriteBatch(sourceID, []Record{record(2)}, ""); err != nil {
+		t.Fatal(err)
+	}
+	after := columns()
+
+	for _, col := range documentColumns {
+		key := col == "source_id" || col == "file_path"
+		if changed := before[col] != after[col]; changed == key {
+			t.Errorf("%s went from %q to %q", col, before[col], after[col])
+		}
+	}
+
+	// a row coming back to the source revives its tombstone
+	var deleted sql.NullString
+	if err := dest.db.QueryRow("SELECT deleted_at FROM documents").Scan(&deleted); err != nil {
+		t.Fatal(err)
+	}
+	if deleted.Valid {
+		t.Errorf("deleted_at = %q after the row came back, want NULL", deleted.String)
+	}
+}
@@ -33,7 +33,9 @@ func filterText(content string) string {
 	return strings.Join(filteredWords, " ")
 }
 
-func ParseColToVec() {
+// ParseColToVec fills content_tsv from documents_data.csv. A non empty
+// collection leaves documents of other collections untouched
+func ParseColToVec(collection string) {
 	// Connect to the database
 	db, err := sql.Open("postgres", os.Getenv("DB_CONN_STRING"))
 	if err != nil {
@@ -70,7 +72,7 @@ func ParseColToVec() {
 		// When batch is full, process it concurrently
 		if len(batch) == BATCH_SIZE {
 			wg.Add(1)
-			go updateBatch(db, batch, &wg)
+			go updateBatch(db, batch, collection, &wg)
 			batch = make([][2]string, 0, BATCH_SIZE)
 		}
 	}
@@ -78,27 +80,28 @@ func ParseColToVec() {
 	// Process any remaining rows
 	if len(batch) > 0 {
 		wg.Add(1)
-		go updateBatch(db, batch, &wg)
+		go updateBatch(db, batch, collection, &wg)
 	}
 
 	wg.Wait() // Wait for all batches to complete
 }
 
 // updateBatch updates the database with a batch of rows
-func updateBatch(db *sql.DB, batch [][2]string, wg *sync.WaitGroup) {
+func updateBatch(db *sql.DB, batch [][2]string, collection string, wg *sync.WaitGroup) {
 	defer wg.Done()
 	tx, err := db.Begin()
 	if err != nil {
 		fmt.Println("Transaction error:", err)
 		return
 	}
-	stmt, err := tx.Prepare("UPDATE documents SET content_tsv = to_tsvector('english', $1) WHERE id = $2")
+	stmt, err := tx.Prepare(`UPDATE documents SET content_tsv = to_tsvector('english', $1)
+        WHERE id = $2 AND ($3 = '' OR source_id IN (SELECT id FROM sync_sources WHERE collection = $3))`)
 	if err != nil {
 		fmt.Println("Prepare error:", err)
 		return
 	}
 	for _, item := range batch {
-		_, err := stmt.Exec(item[1], item[0])
+		_, err := stmt.Exec(item[1], item[0], collection)
 		if err != nil {
 			fmt.Println("Exec error:", err)
 		}
@@ -0,0 +1,75 @@
+package vector
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	// postgres builds the tsvector, the test stores the text as given
+	sql.Register("sqlite3_tsvector", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("to_tsvector", func(config, text string) string { return text }, true)
+		},
+	})
+}
+
+func TestUpdateBatchCollection(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		want       map[int]string
+	}{
+		{"every collection", "", map[int]string{1: "one", 2: "two", 3: "three"}},
+		{"one collection", "reports", map[int]string{1: "one", 2: "", 3: "three"}},
+		{"unknown collection", "letters", map[int]string{1: "", 2: "", 3: ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sql.Open("sqlite3_tsvector", filepath.Join(t.TempDir(), "documents.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			_, err = db.Exec(`
+                CREATE TABLE sync_sources (id INTEGER PRIMARY KEY, collection TEXT);
+                CREATE TABLE documents (id INTEGER PRIMARY KEY, source_id INTEGER, content_tsv TEXT NOT NULL DEFAULT '');
+                INSERT INTO sync_sources VALUES (1, 'reports'), (2, 'memos');
+                INSERT INTO documents (id, source_id) VALUES (1, 1), (2, 2), (3, 1);
+            `)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			updateBatch(db, [][2]string{{"1", "one"}, {"2", "two"}, {"3", "three"}}, tt.collection, &wg)
+			wg.Wait()
+
+			rows, err := db.Query("SELECT id, content_tsv FROM documents")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			got := make(map[int]string)
+			for rows.Next() {
+				var id int
+				var tsv string
+				if err := rows.Scan(&id, &tsv); err != nil {
+					t.Fatal(err)
+				}
+				got[id] = tsv
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("content_tsv = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
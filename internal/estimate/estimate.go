@@ -0,0 +1,145 @@
+package estimate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slice/internal/models"
+	"time"
+)
+
+const (
+	DEFAULT_BYTES_PER_SEC = 1 << 20 // 1MiB/s for mime types without a profile
+)
+
+// Profile describes how fast TheScribe extracts each mime type
+type Profile struct {
+	// DefaultBytesPerSec is used for mime types missing from MimeTypes
+	DefaultBytesPerSec float64            `json:"default_bytes_per_sec"`
+	MimeTypes          map[string]float64 `json:"mime_types"`
+	// PerFileSec is a fixed cost added for every file, e.g. process start
+	PerFileSec float64 `json:"per_file_sec"`
+}
+
+// DefaultProfile returns the profile used when no config file is given
+func DefaultProfile() Profile {
+	return Profile{
+		DefaultBytesPerSec: DEFAULT_BYTES_PER_SEC,
+		MimeTypes:          map[string]float64{},
+	}
+}
+
+// LoadProfile reads a throughput profile from a json config file
+func LoadProfile(fileName string) (Profile, error) {
+	profile := DefaultProfile()
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return profile, err
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return profile, fmt.Errorf("failed to parse profile %s: %v", fileName, err)
+	}
+
+	if profile.DefaultBytesPerSec <= 0 {
+		return profile, fmt.Errorf("default_bytes_per_sec must be positive")
+	}
+	for mimeType, bps := range profile.MimeTypes {
+		if bps <= 0 {
+			return profile, fmt.Errorf("throughput for %s must be positive", mimeType)
+		}
+	}
+
+	return profile, nil
+}
+
+// bytesPerSec returns the throughput for a mime type
+func (p Profile) bytesPerSec(mimeType string) float64 {
+	if bps, ok := p.MimeTypes[mimeType]; ok {
+		return bps
+	}
+	return p.DefaultBytesPerSec
+}
+
+// MimeTotal is the estimate for a single mime type
+type MimeTotal struct {
+	Files    int           `json:"files"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Result is the estimate for a shard or the whole run
+type Result struct {
+	Name     string                `json:"name"`
+	Files    int                   `json:"files"`
+	Bytes    int64                 `json:"bytes"`
+	Unsized  int                   `json:"unsized"`
+	Duration time.Duration         `json:"duration"`
+	ByMime   map[string]*MimeTotal `json:"by_mime"`
+}
+
+// Estimate totals the bytes per mime type of entries and converts
+// them into processing time. Unsized counts entries without a size,
+// which only contribute the per file cost
+func Estimate(name string, entries []models.Entry, profile Profile) Result {
+	result := Result{Name: name, ByMime: make(map[string]*MimeTotal)}
+
+	for _, entry := range entries {
+		mimeType := entry.MimeType
+		if mimeType == "" {
+			mimeType = "unknown"
+		}
+
+		total, ok := result.ByMime[mimeType]
+		if !ok {
+			total = &MimeTotal{}
+			result.ByMime[mimeType] = total
+		}
+
+		// a zero byte file is sized, only a missing size is unknown
+		var size int64
+		if entry.Size != nil {
+			size = *entry.Size
+		} else {
+			result.Unsized++
+		}
+
+		seconds := profile.PerFileSec + float64(size)/profile.bytesPerSec(entry.MimeType)
+		duration := time.Duration(seconds * float64(time.Second))
+
+		total.Files++
+		total.Bytes += size
+		total.Duration += duration
+
+		result.Files++
+		result.Bytes += size
+		result.Duration += duration
+	}
+
+	return result
+}
+
+// Merge combines shard results into an overall result
+func Merge(name string, shards []Result) Result {
+	result := Result{Name: name, ByMime: make(map[string]*MimeTotal)}
+
+	for _, shard := range shards {
+		result.Files += shard.Files
+		result.Bytes += shard.Bytes
+		result.Unsized += shard.Unsized
+		result.Duration += shard.Duration
+
+		for mimeType, t := range shard.ByMime {
+			total, ok := result.ByMime[mimeType]
+			if !ok {
+				total = &MimeTotal{}
+				result.ByMime[mimeType] = total
+			}
+			total.Files += t.Files
+			total.Bytes += t.Bytes
+			total.Duration += t.Duration
+		}
+	}
+
+	return result
+}
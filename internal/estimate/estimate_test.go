@@ -0,0 +1,96 @@
+package estimate
+
+import (
+	"reflect"
+	"slice/internal/models"
+	"testing"
+	"time"
+)
+
+func TestEstimate(t *testing.T) {
+	size := func(n int64) *int64 { return &n }
+	profile := Profile{
+		DefaultBytesPerSec: 100,
+		MimeTypes:          map[string]float64{"application/pdf": 10},
+		PerFileSec:         1,
+	}
+
+	tests := []struct {
+		name    string
+		entries []models.Entry
+		want    Result
+	}{
+		{
+			name:    "empty",
+			entries: nil,
+			want:    Result{Name: "shard", ByMime: map[string]*MimeTotal{}},
+		},
+		{
+			name: "profiled and default mime types",
+			entries: []models.Entry{
+				{MimeType: "application/pdf", Size: size(20)},
+				{MimeType: "text/plain", Size: size(200)},
+			},
+			want: Result{Name: "shard", Files: 2, Bytes: 220, Duration: 6 * time.Second, ByMime: map[string]*MimeTotal{
+				"application/pdf": {Files: 1, Bytes: 20, Duration: 3 * time.Second},
+				"text/plain":      {Files: 1, Bytes: 200, Duration: 3 * time.Second},
+			}},
+		},
+		{
+			name: "zero bytes is sized",
+			entries: []models.Entry{
+				{MimeType: "text/plain", Size: size(0)},
+			},
+			want: Result{Name: "shard", Files: 1, Duration: time.Second, ByMime: map[string]*MimeTotal{
+				"text/plain": {Files: 1, Duration: time.Second},
+			}},
+		},
+		{
+			name: "missing size and mime type",
+			entries: []models.Entry{
+				{},
+			},
+			want: Result{Name: "shard", Files: 1, Unsized: 1, Duration: time.Second, ByMime: map[string]*MimeTotal{
+				"unknown": {Files: 1, Duration: time.Second},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Estimate("shard", tt.entries, profile)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Estimate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	shards := []Result{
+		{Name: "a", Files: 2, Bytes: 30, Unsized: 1, Duration: 3 * time.Second, ByMime: map[string]*MimeTotal{
+			"application/pdf": {Files: 1, Bytes: 30, Duration: 2 * time.Second},
+			"unknown":         {Files: 1, Duration: time.Second},
+		}},
+		{Name: "b", Files: 1, Bytes: 5, Duration: 4 * time.Second, ByMime: map[string]*MimeTotal{
+			"application/pdf": {Files: 1, Bytes: 5, Duration: 4 * time.Second},
+		}},
+	}
+
+	want := Result{Name: "overall", Files: 3, Bytes: 35, Unsized: 1, Duration: 7 * time.Second, ByMime: map[string]*MimeTotal{
+		"application/pdf": {Files: 2, Bytes: 35, Duration: 6 * time.Second},
+		"unknown":         {Files: 1, Duration: time.Second},
+	}}
+	if got := Merge("overall", shards); !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+
+	// the shards are left as they were
+	if shards[0].ByMime["application/pdf"].Files != 1 {
+		t.Errorf("Merge() changed a shard total")
+	}
+
+	if got := Merge("overall", nil); got.Files != 0 || len(got.ByMime) != 0 {
+		t.Errorf("Merge(nil) = %+v, want an empty result", got)
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"slice/internal/types"
+	"time"
+)
 
 // The entry model defines the stucture
 // of the manifest
@@ -9,10 +12,15 @@ type Entry struct {
 	RelativePath  string `json:"relative_path"`
 	FileExtension string `json:"file_extension"`
 	ParserVersion int    `json:"parser_version"`
+	ContentHash   string `json:"content_hash,omitempty"`
+	// Size is nil when the inventory did not record it
+	Size *int64 `json:"size,omitempty"`
 }
 
 type Manifest struct {
-	DateTime time.Time `json:"date_time,omitempty"`
-	Name     string    `json:"name,omitempty"`
-	Nodes    []Entry   `json:"nodes,omitempty"`
+	DType      types.DType `json:"dtype,omitempty"`
+	DateTime   time.Time   `json:"date_time,omitempty"`
+	Name       string      `json:"name,omitempty"`
+	Provenance *Provenance `json:"provenance,omitempty"`
+	Nodes      []Entry     `json:"nodes,omitempty"`
 }
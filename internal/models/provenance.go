@@ -0,0 +1,21 @@
+package models
+
+import (
+	"slice/internal/types"
+	"time"
+)
+
+// The provenance model records where a derived
+// artifact came from. Parent holds the provenance of
+// the source so the chain can be walked back to the
+// index run that produced the data
+type Provenance struct {
+	SourceName     string            `json:"source_name"`
+	SourceType     types.DType       `json:"source_type,omitempty"`
+	SourceFile     string            `json:"source_file,omitempty"`
+	SourceDateTime time.Time         `json:"source_date_time"`
+	SourceDigest   string            `json:"source_digest"`
+	Params         map[string]string `json:"params,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	Parent         *Provenance       `json:"parent,omitempty"`
+}
@@ -3,5 +3,8 @@ package types
 type DType string
 
 const (
-	Subset DType = "Subset"
+	Index     DType = "Index"
+	Subset    DType = "Subset"
+	Import    DType = "Import"
+	Inventory DType = "Inventory"
 )